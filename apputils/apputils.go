@@ -4,202 +4,402 @@ import (
 	"Goclip/db"
 	"Goclip/log"
 	"Goclip/shellutils"
-	"bufio"
-	"io"
+	"Goclip/utils"
 	"io/fs"
-	"io/ioutil"
+	"mime"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 )
 
-func ATime(name string) (atime time.Time) {
-	fi, err := os.Stat(name)
-	if err != nil {
-		return
-	}
-	stat := fi.Sys().(*syscall.Stat_t)
-	atime = time.Unix(stat.Atim.Sec, stat.Atim.Nsec)
-	return
-}
+const iconSize = 32
 
 type DesktopFileParser struct {
-	icons map[string]string
+	icons *IconResolver
 }
 
-func removeExecFieldCodes(value string) string {
-	return strings.NewReplacer(
-		"%f", "",
-		"%F", "",
-		"%u", "",
-		"%U", "",
-		"%d", "",
-		"%D", "",
-		"%n", "",
-		"%N", "",
-		"%i", "",
-		"%c", "",
-		"%k", "",
-		"%v", "",
-		"%m", "").Replace(value)
+func NewDesktopFileParser() *DesktopFileParser {
+	scale := atoiDefault(os.Getenv("GDK_SCALE"), 1)
+	return &DesktopFileParser{icons: NewIconResolver(CurrentIconTheme(), iconSize, scale)}
+}
+
+func (s *DesktopFileParser) findIcon(name string, defaultVal string) string {
+	if fn := s.icons.Lookup(name); fn != "" {
+		return fn
+	}
+	return defaultVal
 }
 
-func getDesktopFileValue(line string, prefix string) string {
-	if !strings.HasPrefix(line, prefix) {
-		return ""
+// ParseDesktopFile returns the launchable entry of a desktop file, nothing when the entry
+// must not be shown in the current desktop or its executable is missing
+func (s *DesktopFileParser) ParseDesktopFile(fn string) ([]*db.AppEntry, error) {
+	desktop, err := ReadDesktopFile(fn)
+	if err != nil {
+		log.Error("Cannot read desktop file: ", err)
+		return nil, err
+	}
+	const group = desktopEntryGroup
+	if !desktop.HasGroup(group) || !isShown(desktop) {
+		return nil, nil
+	}
+	entry := &db.AppEntry{
+		File:        fn,
+		Type:        desktop.String(group, "Type"),
+		Name:        desktop.LocaleString(group, "Name"),
+		GenericName: desktop.LocaleString(group, "GenericName"),
+		Comment:     desktop.LocaleString(group, "Comment"),
+		Keywords:    desktop.LocaleStrings(group, "Keywords"),
+		Categories:  desktop.Strings(group, "Categories"),
+		MimeTypes:   desktop.Strings(group, "MimeType"),
+		Icon:        s.findIcon(desktop.LocaleString(group, "Icon"), ""),
+		Path:        desktop.String(group, "Path"),
+		Terminal:    desktop.Bool(group, "Terminal"),
+	}
+	switch entry.Type {
+	case "Application":
+		entry.Exec = desktop.String(group, "Exec")
+	case "Link":
+		entry.URL = desktop.String(group, "URL")
+		entry.Exec = "xdg-open " + entry.URL
+	default:
+		return nil, nil
 	}
-	parts := strings.Split(line, prefix)
-	if len(parts) < 2 {
-		return ""
+	if entry.Name == "" || strings.TrimSpace(entry.Exec) == "" {
+		return nil, nil
 	}
-	return removeExecFieldCodes(strings.Join(parts[1:], prefix))
+	for _, id := range desktop.Strings(group, "Actions") {
+		actionGroup := "Desktop Action " + id
+		if !desktop.HasGroup(actionGroup) {
+			continue
+		}
+		action := &db.AppAction{
+			Id:   id,
+			Name: desktop.LocaleString(actionGroup, "Name"),
+			Exec: desktop.String(actionGroup, "Exec"),
+			Icon: s.findIcon(desktop.LocaleString(actionGroup, "Icon"), entry.Icon),
+		}
+		if action.Name != "" && strings.TrimSpace(action.Exec) != "" {
+			entry.Actions = append(entry.Actions, action)
+		}
+	}
+	return []*db.AppEntry{entry}, nil
 }
 
-func stripExt(fileName string) string {
-	return fileName[:len(fileName)-len(filepath.Ext(fileName))]
+func currentDesktops() []string {
+	return strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":")
 }
 
-func (s *DesktopFileParser) ListIcons() map[string]string {
-	if s.icons != nil {
-		return s.icons
-	}
-	s.icons = map[string]string{}
-	pathEnv := os.Getenv("XDG_DATA_DIRS")
-	paths := strings.Split(pathEnv, ":")
-	for _, root := range paths {
-		root = filepath.Join(root, "icons")
-		err := filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if strings.HasSuffix(info.Name(), ".png") {
-				key := stripExt(info.Name())
-				if _, found := s.icons[key]; !found {
-					s.icons[stripExt(info.Name())] = path
-				}
-			}
-			return nil
-		})
-		if err == io.EOF {
-			break
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if v != "" && strings.EqualFold(v, value) {
+			return true
 		}
 	}
-	return s.icons
+	return false
 }
 
-func (s *DesktopFileParser) findIcon(name string, defaultVal string) string {
-	if name == "" {
-		return defaultVal
+func isShown(desktop *DesktopFile) bool {
+	const group = desktopEntryGroup
+	if desktop.Bool(group, "NoDisplay") || desktop.Bool(group, "Hidden") {
+		return false
 	}
-	if _, err := os.Stat(name); err == nil {
-		return name
+	desktops := currentDesktops()
+	if onlyShowIn := desktop.Strings(group, "OnlyShowIn"); len(onlyShowIn) > 0 {
+		shown := false
+		for _, d := range desktops {
+			shown = shown || containsFold(onlyShowIn, d)
+		}
+		if !shown {
+			return false
+		}
 	}
-	if s.icons == nil {
-		s.ListIcons()
+	for _, d := range desktops {
+		if containsFold(desktop.Strings(group, "NotShowIn"), d) {
+			return false
+		}
 	}
-	if _, found := s.icons[name]; found {
-		return s.icons[name]
+	if tryExec := desktop.String(group, "TryExec"); tryExec != "" {
+		if _, err := exec.LookPath(tryExec); err != nil {
+			return false
+		}
 	}
-	log.Info("Icon not found:", name)
-	return defaultVal
+	return true
 }
 
-func (s *DesktopFileParser) ParseDesktopFile(fn string) ([]*db.AppEntry, error) {
-	file, err := os.Open(fn)
-	if err != nil {
-		log.Error("Cannot open file: ", err)
-		return nil, err
+type cachedDesktopFile struct {
+	modTime time.Time
+	entries []*db.AppEntry
+}
+
+type AppManager struct {
+	db        db.GoclipDB
+	mu        sync.Mutex
+	cache     map[string]*cachedDesktopFile
+	pathCache map[string]*cachedPathDir
+	reloadCb  func()
+
+	// The parents watched for a missing application directory, with their watch descriptor
+	watchMu       sync.Mutex
+	parentWatches map[string]int
+
+	// The $PATH executables have their own lock, searching them must not wait for a reload
+	execMu      sync.Mutex
+	executables []*db.AppEntry
+
+	customLoaded bool
+	customApps   []*db.CustomApp
+	customCache  []*db.AppEntry
+}
+
+func NewAppManager(myDb db.GoclipDB) *AppManager {
+	return &AppManager{
+		db:            myDb,
+		cache:         map[string]*cachedDesktopFile{},
+		pathCache:     map[string]*cachedPathDir{},
+		parentWatches: map[string]int{},
 	}
-	var entries []*db.AppEntry
-	var entry *db.AppEntry
-	scanner := bufio.NewScanner(file)
-	fileIcon := ""
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "[") {
-			if entry != nil && entry.Exec != "" {
-				entry.Icon = s.findIcon(entry.Icon, fileIcon)
-				entries = append(entries, entry)
-			}
-			entry = &db.AppEntry{
-				AccessTime: ATime(fn),
-				File:       fn,
-			}
+}
+
+func (s *AppManager) SetReloadAppsCallback(f func()) {
+	s.reloadCb = f
+}
+
+// applicationDirs returns the directories containing desktop files, by precedence
+func applicationDirs() []string {
+	data := dataDirs()
+	var roots []string
+	roots = append(roots, data[0])
+	if home, err := os.UserHomeDir(); err == nil {
+		roots = append(roots, filepath.Join(home, ".local", "share", "flatpak", "exports", "share"))
+	}
+	roots = append(roots, "/var/lib/flatpak/exports/share")
+	roots = append(roots, data[1:]...)
+	roots = append(roots, "/var/lib/snapd/desktop")
+
+	var dirs []string
+	found := map[string]bool{}
+	for _, root := range roots {
+		dir := filepath.Join(root, "applications")
+		if !found[dir] {
+			found[dir] = true
+			dirs = append(dirs, dir)
 		}
+	}
+	return dirs
+}
 
-		name := getDesktopFileValue(line, "Name=")
-		if name != "" {
-			entry.Name = name
+// desktopFileId returns the desktop-file ID of fn, its path relative to the applications
+// directory with / replaced by -
+func desktopFileId(dir string, fn string) string {
+	rel, err := filepath.Rel(dir, fn)
+	if err != nil {
+		rel = filepath.Base(fn)
+	}
+	return strings.Replace(rel, string(filepath.Separator), "-", -1)
+}
+
+// LoadApps refreshes the app catalog, parsing only the desktop files changed since the last call.
+// It returns true when the catalog changed.
+func (s *AppManager) LoadApps() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var parser *DesktopFileParser
+	getParser := func() *DesktopFileParser {
+		if parser == nil {
+			parser = NewDesktopFileParser()
 		}
-		icon := getDesktopFileValue(line, "Icon=")
-		if icon != "" {
-			entry.Icon = icon
-			if fileIcon == "" {
-				fileIcon = s.findIcon(entry.Icon, "")
+		return parser
+	}
+	var allEntries []*db.AppEntry
+	seen := map[string]bool{}
+	ids := map[string]bool{}
+	changed := false
+	for _, path := range applicationDirs() {
+		n := 0
+		filepath.WalkDir(path, func(ffile string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if ffile == path && !os.IsNotExist(err) {
+					log.Warning("Cannot read dir content: ", err)
+				}
+				return nil
 			}
-		}
-		exec := getDesktopFileValue(line, "Exec=")
-		if exec != "" {
-			entry.Exec = exec
-		}
-		term := getDesktopFileValue(line, "Terminal=")
-		if term != "" {
-			if term == "true" {
-				entry.Terminal = true
+			if d.IsDir() || !strings.HasSuffix(ffile, ".desktop") {
+				return nil
+			}
+			// The first file with an ID wins, even when hidden
+			id := desktopFileId(path, ffile)
+			if ids[id] {
+				return nil
 			}
+			ids[id] = true
+			finfo, err := os.Stat(ffile)
+			if err != nil {
+				return nil
+			}
+			seen[ffile] = true
+			cached, found := s.cache[ffile]
+			if !found || !cached.modTime.Equal(finfo.ModTime()) {
+				entries, err := getParser().ParseDesktopFile(ffile)
+				if err != nil {
+					return nil
+				}
+				for _, entry := range entries {
+					entry.Id = id
+				}
+				cached = &cachedDesktopFile{modTime: finfo.ModTime(), entries: entries}
+				s.cache[ffile] = cached
+				changed = true
+			}
+			allEntries = append(allEntries, cached.entries...)
+			n += len(cached.entries)
+			return nil
+		})
+		log.Info(path, ": ", n)
+	}
+	for fn := range s.cache {
+		if !seen[fn] {
+			delete(s.cache, fn)
+			changed = true
 		}
 	}
-	if entry.Exec != "" {
-		entry.Icon = s.findIcon(entry.Icon, fileIcon)
-		entries = append(entries, entry)
+	executables, pathChanged := s.loadPathExecutables(allEntries)
+	s.execMu.Lock()
+	s.executables = executables
+	s.execMu.Unlock()
+	custom, customChanged := s.customEntries(getParser)
+	allEntries = append(allEntries, custom...)
+	allEntries = append(allEntries, s.launchedExecutables()...)
+	if !changed && !customChanged && !pathChanged {
+		return false
 	}
-	return entries, nil
+	if err := s.db.AddAppEntries(allEntries); err != nil {
+		log.Error("Error saving app entries: ", err)
+	}
+	return true
 }
 
-type AppManager struct {
-	db db.GoclipDB
+// ReloadApps parses again all the desktop files and $PATH directories, and the custom apps
+func (s *AppManager) ReloadApps() {
+	s.mu.Lock()
+	s.cache = map[string]*cachedDesktopFile{}
+	s.pathCache = map[string]*cachedPathDir{}
+	s.customLoaded = false
+	s.mu.Unlock()
+	s.LoadApps()
 }
 
-func NewAppManager(myDb db.GoclipDB) *AppManager {
-	return &AppManager{db: myDb}
+// GetApps returns the shown apps sorted by frecency, then desktop apps before executables, then by name
+func (s *AppManager) GetApps() []*db.AppEntry {
+	entries := s.applyOverrides(s.db.GetAppEntries())
+	sort.SliceStable(entries, func(i, j int) bool {
+		fi, fj := Frecency(entries[i]), Frecency(entries[j])
+		if fi != fj {
+			return fi > fj
+		}
+		ei, ej := entries[i].Type == TypeExecutable, entries[j].Type == TypeExecutable
+		if ei != ej {
+			return ej
+		}
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+	return entries
 }
 
-func (s *AppManager) LoadApps() {
-	parser := DesktopFileParser{}
-	pathEnv := os.Getenv("XDG_DATA_DIRS")
-	paths := strings.Split(pathEnv, ":")
-	var allEntries []*db.AppEntry
-	for _, path := range paths {
-		path = filepath.Join(path, "applications")
-		files, err := ioutil.ReadDir(path)
-		if err != nil {
-			log.Warning("Cannot read dir content: ", err)
+// AppsFor returns the apps declaring support for the mime type of target, a file or an url
+func (s *AppManager) AppsFor(target string) []*db.AppEntry {
+	mimeType := TargetMimeType(target)
+	if mimeType == "" {
+		return nil
+	}
+	var apps []*db.AppEntry
+	for _, entry := range s.GetApps() {
+		if !AcceptsTargets(entry.Exec) {
 			continue
 		}
-		n := 0
-		for _, finfo := range files {
-			ffile := filepath.Join(path, finfo.Name())
-			entries, err := parser.ParseDesktopFile(ffile)
-			if err != nil {
-				continue
+		for _, m := range entry.MimeTypes {
+			if m == mimeType || (strings.HasSuffix(m, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(m, "*"))) {
+				apps = append(apps, entry)
+				break
 			}
-			allEntries = append(allEntries, entries...)
-			n += len(entries)
 		}
-		log.Info(path, ": ", n)
 	}
-	if err := s.db.AddAppEntries(allEntries); err != nil {
-		log.Error("Error saving app entries: ", err)
+	return apps
+}
+
+// TargetMimeType guesses the mime type of a file or an url
+func TargetMimeType(target string) string {
+	if u, err := url.Parse(target); err == nil && u.Scheme != "" && u.Scheme != "file" {
+		return "x-scheme-handler/" + strings.ToLower(u.Scheme)
+	} else if err == nil && u.Scheme == "file" {
+		target = u.Path
+	}
+	if fi, err := os.Stat(target); err == nil && fi.IsDir() {
+		return "inode/directory"
 	}
+	mimeType := mime.TypeByExtension(filepath.Ext(target))
+	if idx := strings.Index(mimeType, ";"); idx >= 0 {
+		mimeType = mimeType[:idx]
+	}
+	return mimeType
 }
 
-func (s *AppManager) GetApps() []*db.AppEntry {
-	return s.db.GetAppEntries()
+// Frecency is the launch score of an app, each launch adds one and the total halves every week
+func Frecency(entry *db.AppEntry) float64 {
+	return utils.DecayScore(entry.Frecency, entry.AccessTime)
 }
 
-func (s *AppManager) ExecEntry(entry *db.AppEntry) {
-	shellutils.Exec(entry.Exec, entry.Terminal)
-	s.db.UpdateAppEntry(entry)
+// SearchBoost is the ranking bonus of an app in search results
+func SearchBoost(entry *db.AppEntry) int {
+	boost := utils.ScoreBoost(Frecency(entry))
+	if entry.Type == TypeExecutable {
+		boost -= executablePenalty
+	}
+	return boost
+}
+
+func (s *AppManager) inTerminal(entry *db.AppEntry) bool {
+	if entry.Type != TypeExecutable {
+		return entry.Terminal
+	}
+	settings, err := s.db.GetSettings()
+	if err != nil {
+		settings = db.DefaultSettings()
+	}
+	return settings.PathInTerminal
+}
+
+// ExecEntry launches the app, or one of its actions when action is not nil
+func (s *AppManager) ExecEntry(entry *db.AppEntry, action *db.AppAction) {
+	s.OpenWith(entry, action, nil)
+}
+
+// OpenWith launches the app passing targets, files or urls, to its Exec field codes
+func (s *AppManager) OpenWith(entry *db.AppEntry, action *db.AppAction, targets []string) {
+	if entry.Type == "Link" && action == nil {
+		shellutils.Open(entry.URL)
+	} else {
+		exec := entry.Exec
+		if action != nil {
+			exec = action.Exec
+		}
+		args, err := ExpandExec(entry, exec, targets)
+		if err != nil || len(args) == 0 {
+			log.Error("Invalid Exec for ", entry.File, ": ", err)
+			return
+		}
+		shellutils.ExecApp(entry.Id, args, entry.Path, s.inTerminal(entry))
+	}
+	if stored, err := s.db.GetAppEntry(entry.Id); err == nil {
+		entry = stored
+	}
+	entry.Frecency = Frecency(entry) + 1
+	entry.LaunchCount++
+	entry.AccessTime = time.Now()
+	// A $PATH executable is stored with the apps once launched
+	s.db.SaveAppEntry(entry)
 }
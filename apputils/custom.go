@@ -0,0 +1,115 @@
+package apputils
+
+import (
+	"Goclip/db"
+	"Goclip/log"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// TypeCustom is the type of the entries defined by the user in the settings
+const TypeCustom = "Custom"
+
+func customAppId(id int) string {
+	return "custom:" + strconv.Itoa(id)
+}
+
+// customEntries returns the custom apps as app entries, converted again only when they changed
+func (s *AppManager) customEntries(parser func() *DesktopFileParser) ([]*db.AppEntry, bool) {
+	apps := s.db.GetCustomApps()
+	if s.customLoaded && reflect.DeepEqual(apps, s.customApps) {
+		return s.customCache, false
+	}
+	var entries []*db.AppEntry
+	for _, app := range apps {
+		if strings.TrimSpace(app.Name) == "" || strings.TrimSpace(app.Command) == "" {
+			continue
+		}
+		entries = append(entries, &db.AppEntry{
+			Id:       customAppId(app.Id),
+			Type:     TypeCustom,
+			Name:     app.Name,
+			Exec:     "/bin/sh -c " + quoteExecArg(app.Command),
+			Icon:     parser().findIcon(app.Icon, ""),
+			Path:     app.Path,
+			Terminal: app.Terminal,
+			Keywords: app.Keywords,
+		})
+	}
+	s.customApps = apps
+	s.customCache = entries
+	s.customLoaded = true
+	log.Info("Custom apps: ", len(entries))
+	return entries, true
+}
+
+// applyOverrides hides, renames and re-icons the entries as configured by the user
+func (s *AppManager) applyOverrides(entries []*db.AppEntry) []*db.AppEntry {
+	overrides := map[string]*db.AppOverride{}
+	for _, o := range s.db.GetAppOverrides() {
+		overrides[o.AppId] = o
+	}
+	if len(overrides) == 0 {
+		return entries
+	}
+	var shown []*db.AppEntry
+	for _, entry := range entries {
+		if o, found := overrides[entry.Id]; found {
+			if o.Hidden {
+				continue
+			}
+			if o.Name != "" {
+				entry.Name = o.Name
+			}
+			if o.Icon != "" {
+				entry.Icon = o.Icon
+			}
+		}
+		shown = append(shown, entry)
+	}
+	return shown
+}
+
+// GetOverride returns the override of an app, an empty one when there is none
+func (s *AppManager) GetOverride(appId string) *db.AppOverride {
+	for _, o := range s.db.GetAppOverrides() {
+		if o.AppId == appId {
+			return o
+		}
+	}
+	return &db.AppOverride{AppId: appId}
+}
+
+// SaveOverride saves an app override, deleting it when it does not change anything
+func (s *AppManager) SaveOverride(override *db.AppOverride) error {
+	if !override.Hidden && override.Name == "" && override.Icon == "" {
+		return s.db.DeleteAppOverride(override.AppId)
+	}
+	if override.Icon != "" {
+		override.Icon = NewDesktopFileParser().findIcon(override.Icon, override.Icon)
+	}
+	return s.db.SaveAppOverride(override)
+}
+
+// HideApp removes an app from the launcher, until its override is deleted in the settings
+func (s *AppManager) HideApp(entry *db.AppEntry) error {
+	override := s.GetOverride(entry.Id)
+	override.Hidden = true
+	return s.SaveOverride(override)
+}
+
+// RenameApp shows an app with another name, an empty name restores the original one
+func (s *AppManager) RenameApp(entry *db.AppEntry, name string) error {
+	override := s.GetOverride(entry.Id)
+	override.Name = strings.TrimSpace(name)
+	return s.SaveOverride(override)
+}
+
+// SetAppIcon shows an app with another icon, a theme icon name or a file, an empty icon
+// restores the original one
+func (s *AppManager) SetAppIcon(entry *db.AppEntry, icon string) error {
+	override := s.GetOverride(entry.Id)
+	override.Icon = strings.TrimSpace(icon)
+	return s.SaveOverride(override)
+}
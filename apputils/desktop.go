@@ -0,0 +1,194 @@
+package apputils
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+const desktopEntryGroup = "Desktop Entry"
+
+// DesktopFile holds the groups of a freedesktop .desktop file
+// (https://specifications.freedesktop.org/desktop-entry-spec/latest/)
+type DesktopFile struct {
+	Groups []string
+	values map[string]map[string]string
+}
+
+func ReadDesktopFile(fn string) (*DesktopFile, error) {
+	file, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	desktop := &DesktopFile{values: map[string]map[string]string{}}
+	var group map[string]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := line[1 : len(line)-1]
+			if _, found := desktop.values[name]; found {
+				// Duplicate groups are not allowed, ignore the repeated one
+				group = map[string]string{}
+				continue
+			}
+			group = map[string]string{}
+			desktop.values[name] = group
+			desktop.Groups = append(desktop.Groups, name)
+			continue
+		}
+		if group == nil {
+			continue
+		}
+		idx := strings.Index(line, "=")
+		if idx <= 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:idx])
+		if _, found := group[key]; !found {
+			group[key] = strings.TrimSpace(line[idx+1:])
+		}
+	}
+	return desktop, scanner.Err()
+}
+
+func (s *DesktopFile) HasGroup(group string) bool {
+	_, found := s.values[group]
+	return found
+}
+
+// Value returns the raw value of a key
+func (s *DesktopFile) Value(group string, key string) string {
+	return s.values[group][key]
+}
+
+func (s *DesktopFile) String(group string, key string) string {
+	return unescapeValue(s.Value(group, key))
+}
+
+func (s *DesktopFile) Bool(group string, key string) bool {
+	return s.Value(group, key) == "true"
+}
+
+func (s *DesktopFile) Strings(group string, key string) []string {
+	return splitValues(s.Value(group, key))
+}
+
+// LocaleString returns the value of key[locale] best matching the current locale
+func (s *DesktopFile) LocaleString(group string, key string) string {
+	return unescapeValue(s.localeValue(group, key))
+}
+
+func (s *DesktopFile) LocaleStrings(group string, key string) []string {
+	return splitValues(s.localeValue(group, key))
+}
+
+func (s *DesktopFile) localeValue(group string, key string) string {
+	values := s.values[group]
+	for _, locale := range localeVariants(currentLocale()) {
+		if value, found := values[key+"["+locale+"]"]; found {
+			return value
+		}
+	}
+	return values[key]
+}
+
+func currentLocale() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(env); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// localeVariants lists the keys to try for a lang_COUNTRY.ENCODING@MODIFIER locale, in the spec order:
+// lang_COUNTRY@MODIFIER, lang_COUNTRY, lang@MODIFIER, lang
+func localeVariants(locale string) []string {
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return nil
+	}
+	modifier := ""
+	if idx := strings.Index(locale, "@"); idx >= 0 {
+		modifier = locale[idx:]
+		locale = locale[:idx]
+	}
+	if idx := strings.Index(locale, "."); idx >= 0 {
+		locale = locale[:idx]
+	}
+	lang, country := locale, ""
+	if idx := strings.Index(locale, "_"); idx >= 0 {
+		lang, country = locale[:idx], locale[idx:]
+	}
+	var variants []string
+	if country != "" && modifier != "" {
+		variants = append(variants, lang+country+modifier)
+	}
+	if country != "" {
+		variants = append(variants, lang+country)
+	}
+	if modifier != "" {
+		variants = append(variants, lang+modifier)
+	}
+	return append(variants, lang)
+}
+
+func unescapeValue(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i == len(value)-1 {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 's':
+			b.WriteByte(' ')
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '\\':
+			b.WriteByte('\\')
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// splitValues splits a list value on unescaped semicolons
+func splitValues(value string) []string {
+	var values []string
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == ';':
+			b.WriteByte(';')
+			i++
+		case value[i] == '\\' && i+1 < len(value):
+			b.WriteByte(value[i])
+			b.WriteByte(value[i+1])
+			i++
+		case value[i] == ';':
+			values = append(values, unescapeValue(b.String()))
+			b.Reset()
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	if b.Len() > 0 {
+		values = append(values, unescapeValue(b.String()))
+	}
+	return values
+}
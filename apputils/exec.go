@@ -0,0 +1,142 @@
+package apputils
+
+import (
+	"Goclip/db"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// SplitExec splits an Exec value into arguments. Arguments are separated by spaces and can be
+// quoted with double quotes, where \", \`, \$ and \\ are escaped.
+func SplitExec(value string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	quoted := false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(value) && strings.IndexByte("\"`$\\", value[i+1]) >= 0:
+			i++
+			arg.WriteByte(value[i])
+		case c == '"':
+			quoted = !quoted
+			inArg = true
+		case !quoted && (c == ' ' || c == '\t' || c == '\n'):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote in Exec: " + value)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// quoteExecArg quotes an argument for an Exec value
+func quoteExecArg(arg string) string {
+	arg = strings.Replace(arg, "%", "%%", -1)
+	if !strings.ContainsAny(arg, " \t\n\"'\\><~|&;$*?#()`") {
+		return arg
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range arg {
+		if strings.ContainsRune("\"`$\\", c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// targetPaths converts targets to local paths, dropping the remote urls
+func targetPaths(targets []string) []string {
+	var paths []string
+	for _, target := range targets {
+		if u, err := url.Parse(target); err == nil && u.Scheme != "" {
+			if u.Scheme == "file" {
+				paths = append(paths, u.Path)
+			}
+			continue
+		}
+		paths = append(paths, target)
+	}
+	return paths
+}
+
+// ExpandExec returns the arguments of an Exec value with its field codes expanded,
+// targets are the files or urls to open.
+func ExpandExec(entry *db.AppEntry, exec string, targets []string) ([]string, error) {
+	tokens, err := SplitExec(exec)
+	if err != nil {
+		return nil, err
+	}
+	paths := targetPaths(targets)
+	var args []string
+	for _, token := range tokens {
+		switch token {
+		case "%F":
+			args = append(args, paths...)
+			continue
+		case "%U":
+			args = append(args, targets...)
+			continue
+		case "%i":
+			if entry.Icon != "" {
+				args = append(args, "--icon", entry.Icon)
+			}
+			continue
+		}
+		var arg strings.Builder
+		for i := 0; i < len(token); i++ {
+			if token[i] != '%' || i == len(token)-1 {
+				arg.WriteByte(token[i])
+				continue
+			}
+			i++
+			switch token[i] {
+			case '%':
+				arg.WriteByte('%')
+			case 'f':
+				if len(paths) > 0 {
+					arg.WriteString(paths[0])
+				}
+			case 'u':
+				if len(targets) > 0 {
+					arg.WriteString(targets[0])
+				}
+			case 'c':
+				arg.WriteString(entry.Name)
+			case 'k':
+				arg.WriteString(entry.File)
+			}
+			// Deprecated and unknown field codes are removed
+		}
+		if arg.Len() > 0 || !strings.Contains(token, "%") {
+			args = append(args, arg.String())
+		}
+	}
+	return args, nil
+}
+
+// AcceptsTargets tells whether the Exec value takes files or urls
+func AcceptsTargets(exec string) bool {
+	for _, code := range []string{"%f", "%F", "%u", "%U"} {
+		if strings.Contains(exec, code) {
+			return true
+		}
+	}
+	return false
+}
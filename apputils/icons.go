@@ -0,0 +1,316 @@
+package apputils
+
+import (
+	"Goclip/log"
+	"bufio"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const defaultIconTheme = "hicolor"
+const iconThemeGroup = "Icon Theme"
+
+var iconExts = []string{".png", ".svg", ".xpm"}
+
+type iconDir struct {
+	path      string
+	size      int
+	scale     int
+	minSize   int
+	maxSize   int
+	threshold int
+	typ       string
+}
+
+type iconTheme struct {
+	name    string
+	parents []string
+	dirs    []*iconDir
+}
+
+// IconResolver finds icons by name following the freedesktop icon theme spec
+// (https://specifications.freedesktop.org/icon-theme-spec/latest/)
+type IconResolver struct {
+	theme    string
+	size     int
+	scale    int
+	baseDirs []string
+	themes   map[string]*iconTheme
+	listings map[string]map[string]bool
+	cache    map[string]string
+}
+
+func NewIconResolver(theme string, size int, scale int) *IconResolver {
+	if theme == "" {
+		theme = defaultIconTheme
+	}
+	return &IconResolver{
+		theme:    theme,
+		size:     size,
+		scale:    scale,
+		baseDirs: iconBaseDirs(),
+		themes:   map[string]*iconTheme{},
+		listings: map[string]map[string]bool{},
+		cache:    map[string]string{},
+	}
+}
+
+func iconBaseDirs() []string {
+	var dirs []string
+	home, _ := os.UserHomeDir()
+	if home != "" {
+		dirs = append(dirs, filepath.Join(home, ".icons"))
+	}
+	for _, dir := range dataDirs() {
+		dirs = append(dirs, filepath.Join(dir, "icons"))
+	}
+	return append(dirs, "/usr/share/pixmaps")
+}
+
+// dataDirs returns $XDG_DATA_HOME followed by $XDG_DATA_DIRS, with their defaults
+func dataDirs() []string {
+	var dirs []string
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+	}
+	if dataHome != "" {
+		dirs = append(dirs, dataHome)
+	}
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+	for _, dir := range strings.Split(dataDirs, ":") {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// CurrentIconTheme returns the icon theme configured for GTK
+func CurrentIconTheme() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		if file, err := os.Open(filepath.Join(home, ".config", "gtk-3.0", "settings.ini")); err == nil {
+			defer file.Close()
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if strings.HasPrefix(line, "gtk-icon-theme-name") {
+					if idx := strings.Index(line, "="); idx > 0 {
+						return strings.Trim(strings.TrimSpace(line[idx+1:]), `"`)
+					}
+				}
+			}
+		}
+	}
+	if out, err := exec.Command("gsettings", "get", "org.gnome.desktop.interface", "icon-theme").Output(); err == nil {
+		if theme := strings.Trim(strings.TrimSpace(string(out)), "'"); theme != "" {
+			return theme
+		}
+	}
+	return defaultIconTheme
+}
+
+func (s *IconResolver) loadTheme(name string) *iconTheme {
+	if theme, found := s.themes[name]; found {
+		return theme
+	}
+	var theme *iconTheme
+	for _, base := range s.baseDirs {
+		index, err := ReadDesktopFile(filepath.Join(base, name, "index.theme"))
+		if err != nil || !index.HasGroup(iconThemeGroup) {
+			continue
+		}
+		theme = &iconTheme{name: name}
+		for _, parent := range strings.Split(index.Value(iconThemeGroup, "Inherits"), ",") {
+			if parent = strings.TrimSpace(parent); parent != "" {
+				theme.parents = append(theme.parents, parent)
+			}
+		}
+		dirs := index.Value(iconThemeGroup, "Directories") + "," + index.Value(iconThemeGroup, "ScaledDirectories")
+		for _, dir := range strings.Split(dirs, ",") {
+			if dir = strings.TrimSpace(dir); dir == "" || !index.HasGroup(dir) {
+				continue
+			}
+			d := &iconDir{
+				path:      dir,
+				size:      atoiDefault(index.Value(dir, "Size"), 0),
+				scale:     atoiDefault(index.Value(dir, "Scale"), 1),
+				threshold: atoiDefault(index.Value(dir, "Threshold"), 2),
+				typ:       index.Value(dir, "Type"),
+			}
+			d.minSize = atoiDefault(index.Value(dir, "MinSize"), d.size)
+			d.maxSize = atoiDefault(index.Value(dir, "MaxSize"), d.size)
+			if d.typ == "" {
+				d.typ = "Threshold"
+			}
+			theme.dirs = append(theme.dirs, d)
+		}
+		break
+	}
+	s.themes[name] = theme
+	return theme
+}
+
+func atoiDefault(value string, defaultVal int) int {
+	if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		return n
+	}
+	return defaultVal
+}
+
+func (s *iconDir) matchesSize(size int, scale int) bool {
+	if s.scale != scale {
+		return false
+	}
+	switch s.typ {
+	case "Fixed":
+		return s.size == size
+	case "Scalable":
+		return s.minSize <= size && size <= s.maxSize
+	}
+	return s.size-s.threshold <= size && size <= s.size+s.threshold
+}
+
+func (s *iconDir) sizeDistance(size int, scale int) int {
+	abs := func(n int) int {
+		if n < 0 {
+			return -n
+		}
+		return n
+	}
+	switch s.typ {
+	case "Fixed":
+		return abs(s.size*s.scale - size*scale)
+	case "Scalable":
+		if size*scale < s.minSize*s.scale {
+			return s.minSize*s.scale - size*scale
+		}
+		if size*scale > s.maxSize*s.scale {
+			return size*scale - s.maxSize*s.scale
+		}
+		return 0
+	}
+	if size*scale < (s.size-s.threshold)*s.scale {
+		return s.minSize*s.scale - size*scale
+	}
+	if size*scale > (s.size+s.threshold)*s.scale {
+		return size*scale - s.maxSize*s.scale
+	}
+	return 0
+}
+
+// findFile looks for name with one of the icon extensions in dir, reading each directory once
+func (s *IconResolver) findFile(dir string, name string) string {
+	listing, found := s.listings[dir]
+	if !found {
+		listing = map[string]bool{}
+		if files, err := ioutil.ReadDir(dir); err == nil {
+			for _, file := range files {
+				listing[file.Name()] = true
+			}
+		}
+		s.listings[dir] = listing
+	}
+	for _, ext := range iconExts {
+		if listing[name+ext] {
+			return filepath.Join(dir, name+ext)
+		}
+	}
+	return ""
+}
+
+func (s *IconResolver) lookupIcon(theme *iconTheme, name string) string {
+	for _, dir := range theme.dirs {
+		if !dir.matchesSize(s.size, s.scale) {
+			continue
+		}
+		for _, base := range s.baseDirs {
+			if fn := s.findFile(filepath.Join(base, theme.name, dir.path), name); fn != "" {
+				return fn
+			}
+		}
+	}
+	closest := ""
+	minDistance := int(^uint(0) >> 1)
+	for _, dir := range theme.dirs {
+		distance := dir.sizeDistance(s.size, s.scale)
+		if distance >= minDistance {
+			continue
+		}
+		for _, base := range s.baseDirs {
+			if fn := s.findFile(filepath.Join(base, theme.name, dir.path), name); fn != "" {
+				closest = fn
+				minDistance = distance
+				break
+			}
+		}
+	}
+	return closest
+}
+
+func (s *IconResolver) lookupInTheme(themeName string, name string, visited map[string]bool) string {
+	if visited[themeName] {
+		return ""
+	}
+	visited[themeName] = true
+	theme := s.loadTheme(themeName)
+	if theme == nil {
+		return ""
+	}
+	if fn := s.lookupIcon(theme, name); fn != "" {
+		return fn
+	}
+	for _, parent := range theme.parents {
+		if fn := s.lookupInTheme(parent, name, visited); fn != "" {
+			return fn
+		}
+	}
+	return ""
+}
+
+// Lookup returns the path of the icon, an empty string if not found
+func (s *IconResolver) Lookup(name string) string {
+	if name == "" {
+		return ""
+	}
+	if filepath.IsAbs(name) {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+		return ""
+	}
+	if fn, found := s.cache[name]; found {
+		return fn
+	}
+	// Some desktop files wrongly include the extension
+	iconName := name
+	for _, ext := range iconExts {
+		iconName = strings.TrimSuffix(iconName, ext)
+	}
+	visited := map[string]bool{}
+	fn := s.lookupInTheme(s.theme, iconName, visited)
+	if fn == "" {
+		fn = s.lookupInTheme(defaultIconTheme, iconName, visited)
+	}
+	if fn == "" {
+		for _, base := range s.baseDirs {
+			if fn = s.findFile(base, iconName); fn != "" {
+				break
+			}
+		}
+	}
+	if fn == "" {
+		log.Info("Icon not found: ", name)
+	}
+	s.cache[name] = fn
+	return fn
+}
@@ -0,0 +1,173 @@
+package apputils
+
+import (
+	"Goclip/db"
+	"Goclip/log"
+	"Goclip/shellutils"
+	"Goclip/utils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// TypeExecutable is the type of the entries found on $PATH, which have no desktop file
+const TypeExecutable = "Executable"
+
+// executablePenalty ranks the executables below the desktop apps matching as well
+const executablePenalty = 24
+
+type cachedPathDir struct {
+	modTime time.Time
+	files   []string
+}
+
+// pathDirs returns the existing directories of the $PATH of the launched programs, without duplicates
+func pathDirs() []string {
+	var dirs []string
+	found := map[string]bool{}
+	for _, dir := range filepath.SplitList(shellutils.LaunchPath()) {
+		if dir == "" {
+			continue
+		}
+		dir = filepath.Clean(dir)
+		if found[dir] {
+			continue
+		}
+		found[dir] = true
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// loadPathDir returns the executables of dir, read again only when dir changed
+func (s *AppManager) loadPathDir(dir string) ([]string, bool) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, false
+	}
+	if cached, found := s.pathCache[dir]; found && cached.modTime.Equal(fi.ModTime()) {
+		return cached.files, false
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Warning("Cannot read dir content: ", err)
+		return nil, false
+	}
+	var executables []string
+	for _, finfo := range files {
+		fn := filepath.Join(dir, finfo.Name())
+		if finfo.Mode()&os.ModeSymlink != 0 {
+			if finfo, err = os.Stat(fn); err != nil {
+				continue
+			}
+		}
+		if finfo.Mode().IsRegular() && finfo.Mode().Perm()&0111 != 0 {
+			executables = append(executables, fn)
+		}
+	}
+	s.pathCache[dir] = &cachedPathDir{modTime: fi.ModTime(), files: executables}
+	return executables, true
+}
+
+// loadPathExecutables returns an entry for each command on $PATH, the first directory
+// having a command wins like in the shell. Commands already launched by a desktop app are skipped.
+// The entries are kept in memory, only the launched ones are stored with the apps.
+func (s *AppManager) loadPathExecutables(apps []*db.AppEntry) ([]*db.AppEntry, bool) {
+	launched := map[string]bool{}
+	for _, app := range apps {
+		if args, err := SplitExec(app.Exec); err == nil && len(args) > 0 {
+			launched[filepath.Base(args[0])] = true
+		}
+	}
+	var entries []*db.AppEntry
+	names := map[string]bool{}
+	seen := map[string]bool{}
+	changed := false
+	for _, dir := range pathDirs() {
+		seen[dir] = true
+		files, dirChanged := s.loadPathDir(dir)
+		changed = changed || dirChanged
+		for _, fn := range files {
+			name := filepath.Base(fn)
+			if names[name] {
+				continue
+			}
+			names[name] = true
+			if launched[name] {
+				continue
+			}
+			entries = append(entries, &db.AppEntry{
+				Id:      "path:" + name,
+				Type:    TypeExecutable,
+				Name:    name,
+				Comment: fn,
+				Exec:    quoteExecArg(fn),
+				File:    fn,
+			})
+		}
+	}
+	for dir := range s.pathCache {
+		if !seen[dir] {
+			delete(s.pathCache, dir)
+			changed = true
+		}
+	}
+	log.Info("PATH executables: ", len(entries))
+	return entries, changed
+}
+
+// launchedExecutables returns the executables launched at least once, stored with the apps
+func (s *AppManager) launchedExecutables() []*db.AppEntry {
+	stored := map[string]bool{}
+	for _, entry := range s.db.GetAppEntries() {
+		if entry.Type == TypeExecutable && entry.LaunchCount > 0 {
+			stored[entry.Id] = true
+		}
+	}
+	var launched []*db.AppEntry
+	for _, entry := range s.executables {
+		if stored[entry.Id] {
+			launched = append(launched, entry)
+		}
+	}
+	return launched
+}
+
+// FindExecutables returns the $PATH executables best matching text, skipping the ids in skip
+func (s *AppManager) FindExecutables(text string, skip map[string]bool, limit int) []*db.AppEntry {
+	s.execMu.Lock()
+	var candidates []*db.AppEntry
+	for _, entry := range s.executables {
+		if !skip[entry.Id] {
+			// Copied, the overrides change the entries
+			e := *entry
+			candidates = append(candidates, &e)
+		}
+	}
+	s.execMu.Unlock()
+	type match struct {
+		entry *db.AppEntry
+		score int
+	}
+	var matches []match
+	for _, entry := range s.applyOverrides(candidates) {
+		if score, _, ok := utils.FuzzyMatch(text, entry.Name); ok {
+			matches = append(matches, match{entry: entry, score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	entries := make([]*db.AppEntry, len(matches))
+	for i, m := range matches {
+		entries[i] = m.entry
+	}
+	return entries
+}
@@ -0,0 +1,127 @@
+package apputils
+
+import (
+	"Goclip/log"
+	"golang.org/x/sys/unix"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const watchDelay = 500 * time.Millisecond
+const watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_CLOSE_WRITE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ATTRIB
+
+// parentMask only notices the creation of a missing directory
+const parentMask = unix.IN_CREATE | unix.IN_MOVED_TO
+
+// StartWatcher loads the apps, then reloads them when the application or $PATH directories change
+func (s *AppManager) StartWatcher() {
+	if s.LoadApps() && s.reloadCb != nil {
+		s.reloadCb()
+	}
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		log.Error("Cannot start app watcher: ", err)
+		return
+	}
+	s.addWatches(fd)
+	go s.watch(fd)
+}
+
+// addWatches watches the application directories and their subdirectories, and the $PATH directories,
+// adding an existing watch again is harmless. A missing application directory is watched through
+// its nearest existing parent, so that its creation is noticed, until it exists.
+func (s *AppManager) addWatches(fd int) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	watched := map[string]bool{}
+	parents := map[string]bool{}
+	for _, dir := range applicationDirs() {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if parent := existingParent(dir); parent != "" {
+				parents[parent] = true
+			}
+			continue
+		}
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			if _, err := unix.InotifyAddWatch(fd, path, watchMask); err != nil {
+				log.Warning("Cannot watch ", path, ": ", err)
+			}
+			watched[path] = true
+			return nil
+		})
+	}
+	for _, dir := range pathDirs() {
+		if _, err := unix.InotifyAddWatch(fd, dir, watchMask); err != nil {
+			log.Warning("Cannot watch ", dir, ": ", err)
+		}
+		watched[dir] = true
+	}
+	// A directory has a single watch, a parent also watched for its content keeps it
+	for parent, wd := range s.parentWatches {
+		if parents[parent] && !watched[parent] {
+			continue
+		}
+		if !watched[parent] {
+			if _, err := unix.InotifyRmWatch(fd, uint32(wd)); err != nil {
+				log.Warning("Cannot remove watch of ", parent, ": ", err)
+			}
+		}
+		delete(s.parentWatches, parent)
+	}
+	for parent := range parents {
+		if _, found := s.parentWatches[parent]; found || watched[parent] {
+			continue
+		}
+		wd, err := unix.InotifyAddWatch(fd, parent, parentMask)
+		if err != nil {
+			log.Warning("Cannot watch ", parent, ": ", err)
+			continue
+		}
+		s.parentWatches[parent] = wd
+	}
+}
+
+// existingParent returns the nearest existing parent directory of dir
+func existingParent(dir string) string {
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		if fi, err := os.Stat(parent); err == nil && fi.IsDir() {
+			return parent
+		}
+		dir = parent
+	}
+}
+
+func (s *AppManager) watch(fd int) {
+	defer unix.Close(fd)
+	var timer *time.Timer
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		if _, err := unix.Read(fd, buf); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			log.Error("Error reading app watcher events: ", err)
+			return
+		}
+		// Installing a package touches many files, reload once they are all written
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.AfterFunc(watchDelay, func() {
+			log.Info("Application or PATH directories changed, reloading apps...")
+			s.addWatches(fd)
+			if s.LoadApps() && s.reloadCb != nil {
+				s.reloadCb()
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package cliputils
+
+import (
+	"Goclip/db"
+	"Goclip/imgutils"
+	"Goclip/shellutils"
+	"strings"
+)
+
+type EntryAction struct {
+	Group   string
+	Label   string
+	Prompt  string
+	Default string
+	Run     func(entry *db.ClipboardEntry, input string) error
+}
+
+type imageEdit struct {
+	label  string
+	prompt string
+	mime   string
+	apply  func(data []byte, input string) ([]byte, string, error)
+}
+
+func resizePercent(percent int) func([]byte, string) ([]byte, string, error) {
+	return func(data []byte, _ string) ([]byte, string, error) {
+		return imgutils.ResizePercent(data, percent)
+	}
+}
+
+func resizeMax(maxSize int) func([]byte, string) ([]byte, string, error) {
+	return func(data []byte, _ string) ([]byte, string, error) {
+		return imgutils.ResizeMax(data, maxSize)
+	}
+}
+
+func rotate(degrees int) func([]byte, string) ([]byte, string, error) {
+	return func(data []byte, _ string) ([]byte, string, error) {
+		return imgutils.Rotate(data, degrees)
+	}
+}
+
+func convert(mime string) func([]byte, string) ([]byte, string, error) {
+	return func(data []byte, _ string) ([]byte, string, error) {
+		return imgutils.Convert(data, mime)
+	}
+}
+
+var imageEdits = []imageEdit{
+	{label: "Resize 50%", apply: resizePercent(50)},
+	{label: "Resize 25%", apply: resizePercent(25)},
+	{label: "Max 1920px", apply: resizeMax(1920)},
+	{label: "Max 1024px", apply: resizeMax(1024)},
+	{label: "Max 512px", apply: resizeMax(512)},
+	{label: "Resize...", prompt: "Percentage (50%) or maximum size (800):", apply: imgutils.Resize},
+	{label: "Crop...", prompt: "Geometry (WxH+X+Y):", apply: imgutils.Crop},
+	{label: "Rotate 90°", apply: rotate(90)},
+	{label: "Rotate 180°", apply: rotate(180)},
+	{label: "Rotate 270°", apply: rotate(270)},
+	{label: "Convert to PNG", mime: imgutils.MimePng, apply: convert(imgutils.MimePng)},
+	{label: "Convert to JPEG", mime: imgutils.MimeJpeg, apply: convert(imgutils.MimeJpeg)},
+	{label: "Convert to WebP", mime: imgutils.MimeWebp, apply: convert(imgutils.MimeWebp)},
+}
+
+func (s *ClipboardManager) EntryActions(entry *db.ClipboardEntry) []*EntryAction {
+	actions := []*EntryAction{
+		{Label: "Open", Run: func(entry *db.ClipboardEntry, _ string) error {
+			shellutils.OpenEntry(entry)
+			return nil
+		}},
+	}
+	if entry.Class == "" {
+		entry.Class = Classify(entry.Mime, entry.Data)
+	}
+	if len(entry.Original) > 0 {
+		original := string(entry.Original)
+		actions = append(actions, &EntryAction{Label: "Copy original", Run: func(*db.ClipboardEntry, string) error {
+			s.WriteText(original)
+			return nil
+		}})
+	}
+	actions = append(actions, s.classActions(entry)...)
+	actions = append(actions, s.openWithActions(entry)...)
+	actions = append(actions, s.organizeActions(entry)...)
+	if entry.IsImage() {
+		actions = append(actions, s.imageActions()...)
+	}
+	if entry.IsText() && s.scripts != nil {
+		actions = append(actions, s.scriptActions()...)
+	}
+	return actions
+}
+
+func (s *ClipboardManager) openWithActions(entry *db.ClipboardEntry) []*EntryAction {
+	if s.apps == nil {
+		return nil
+	}
+	text := strings.TrimSpace(string(entry.Data))
+	var target string
+	switch entry.Class {
+	case db.ClassURL:
+		target = text
+		if strings.HasPrefix(strings.ToLower(text), "www.") {
+			target = "http://" + text
+		}
+	case db.ClassPath:
+		target = expandPath(text)
+	default:
+		return nil
+	}
+	var actions []*EntryAction
+	for _, app := range s.apps.AppsFor(target) {
+		a := app
+		actions = append(actions, &EntryAction{Group: "Open with", Label: a.Name, Run: func(*db.ClipboardEntry, string) error {
+			s.apps.OpenWith(a, nil, []string{target})
+			return nil
+		}})
+	}
+	return actions
+}
+
+func (s *ClipboardManager) scriptActions() []*EntryAction {
+	var actions []*EntryAction
+	for _, transform := range s.scripts.GetTransforms() {
+		t := transform
+		actions = append(actions, &EntryAction{
+			Group: "Scripts",
+			Label: t.Name,
+			Run: func(entry *db.ClipboardEntry, _ string) error {
+				text, err := s.scripts.RunTransform(t, string(entry.Data))
+				if err != nil {
+					return err
+				}
+				s.WriteEntry(&db.ClipboardEntry{Mime: "text/plain", Data: []byte(text)})
+				return nil
+			},
+		})
+	}
+	return actions
+}
+
+func (s *ClipboardManager) imageActions() []*EntryAction {
+	var actions []*EntryAction
+	for i := range imageEdits {
+		edit := imageEdits[i]
+		if edit.mime != "" && !imgutils.CanEncode(edit.mime) {
+			continue
+		}
+		actions = append(actions, &EntryAction{
+			Group:  "Edit image",
+			Label:  edit.label,
+			Prompt: edit.prompt,
+			Run: func(entry *db.ClipboardEntry, input string) error {
+				return s.SaveTransformedImage(entry, func(data []byte) ([]byte, string, error) {
+					return edit.apply(data, input)
+				})
+			},
+		})
+	}
+	for i := range imageEdits {
+		edit := imageEdits[i]
+		// The clipboard only carries png images, a converted image would be pasted as png
+		if edit.mime != "" {
+			continue
+		}
+		actions = append(actions, &EntryAction{
+			Group:  "Paste as",
+			Label:  edit.label,
+			Prompt: edit.prompt,
+			Run: func(entry *db.ClipboardEntry, input string) error {
+				return s.WriteTransformedImage(entry, func(data []byte) ([]byte, string, error) {
+					return edit.apply(data, input)
+				})
+			},
+		})
+	}
+	return actions
+}
@@ -0,0 +1,272 @@
+package cliputils
+
+import (
+	"Goclip/db"
+	"Goclip/shellutils"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	urlRegex        = regexp.MustCompile(`^(?i)(https?|ftp|file)://\S+$|^www\.\S+\.\S+$`)
+	emailRegex      = regexp.MustCompile(`^(?i)(mailto:)?[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,}$`)
+	hexColorRegex   = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	rgbColorRegex   = regexp.MustCompile(`^(?i)rgba?\(\s*(\d{1,3})\s*,\s*(\d{1,3})\s*,\s*(\d{1,3})\s*(,\s*[\d.]+%?\s*)?\)$`)
+	numberRegex     = regexp.MustCompile(`^[-+]?(\d[\d,_]*(\.\d+)?([eE][-+]?\d+)?|0[xX][0-9a-fA-F]+)$`)
+	groupedRegex    = regexp.MustCompile(`^[-+]?\d{1,3}( \d{3})+(\.\d+)?$`)
+	phoneRegex      = regexp.MustCompile(`^\+?[\d\s\-().]{7,20}$`)
+	isoDateRegex    = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	dottedQuadRegex = regexp.MustCompile(`^\d{1,3}(\.\d{1,3}){3}$`)
+	codeLineRegex   = regexp.MustCompile(`[;{}]\s*$|^\s*(func|def|class|import|package|return|if|for|while|var|let|const|#include|public|private)\b|=>|:=`)
+	digitsRegex     = regexp.MustCompile(`\d`)
+	separatorRegex  = regexp.MustCompile(`[,_\s]`)
+	nonDialRegex    = regexp.MustCompile(`[^\d+]`)
+)
+
+func Classify(mime string, data []byte) string {
+	if strings.Contains(mime, "image") {
+		return db.ClassImage
+	}
+	text := strings.TrimSpace(string(data))
+	if text == "" {
+		return db.ClassText
+	}
+	singleLine := !strings.Contains(text, "\n")
+	switch {
+	case singleLine && urlRegex.MatchString(text):
+		return db.ClassURL
+	case singleLine && emailRegex.MatchString(text):
+		return db.ClassEmail
+	case singleLine && isPath(text):
+		return db.ClassPath
+	case singleLine && (isHexColor(text) || rgbColorRegex.MatchString(text)):
+		return db.ClassColor
+	case (strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[")) && json.Valid([]byte(text)):
+		return db.ClassJSON
+	case singleLine && (numberRegex.MatchString(text) || groupedRegex.MatchString(text)):
+		return db.ClassNumber
+	case singleLine && isPhone(text):
+		return db.ClassPhone
+	case isCode(text):
+		return db.ClassCode
+	}
+	return db.ClassText
+}
+
+func isPath(text string) bool {
+	if !strings.HasPrefix(text, "/") && !strings.HasPrefix(text, "~/") {
+		return false
+	}
+	_, err := os.Stat(expandPath(text))
+	return err == nil
+}
+
+func expandPath(text string) string {
+	if path, err := shellutils.ExpandUserDir(text); err == nil {
+		return path
+	}
+	return text
+}
+
+// isHexColor tells whether text is a hex color. A short code made of digits only, like an
+// issue number (#123), is not one.
+func isHexColor(text string) bool {
+	if !hexColorRegex.MatchString(text) {
+		return false
+	}
+	return len(text) != 4 || strings.ContainsAny(strings.ToLower(text), "abcdef")
+}
+
+// isPhone tells whether text is a phone number, written with separators so that plain numbers,
+// dates and IP addresses are not taken for one
+func isPhone(text string) bool {
+	if !phoneRegex.MatchString(text) || isoDateRegex.MatchString(text) || dottedQuadRegex.MatchString(text) {
+		return false
+	}
+	// A leading sign is not a separator
+	body := strings.TrimLeft(text, "+-")
+	if !strings.ContainsAny(body, " -()") && strings.Count(body, ".") < 2 {
+		return false
+	}
+	digits := len(digitsRegex.FindAllString(text, -1))
+	return digits >= 7 && digits <= 15
+}
+
+func isCode(text string) bool {
+	matches := 0
+	for _, line := range strings.Split(text, "\n") {
+		if codeLineRegex.MatchString(line) {
+			matches++
+		}
+	}
+	return matches >= 2
+}
+
+// dedent removes the indentation common to all the non blank lines
+func dedent(text string) string {
+	lines := strings.Split(text, "\n")
+	prefix := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			prefix, first = indent, false
+			continue
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, prefix)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func ColorHex(text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if isHexColor(text) {
+		if len(text) == 4 {
+			return "#" + strings.Repeat(text[1:2], 2) + strings.Repeat(text[2:3], 2) + strings.Repeat(text[3:4], 2), true
+		}
+		return text[:7], true
+	}
+	matches := rgbColorRegex.FindStringSubmatch(text)
+	if len(matches) < 4 {
+		return "", false
+	}
+	var rgb [3]int
+	for i := range rgb {
+		value, err := strconv.Atoi(matches[i+1])
+		if err != nil || value > 255 {
+			return "", false
+		}
+		rgb[i] = value
+	}
+	return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2]), true
+}
+
+func colorRGB(text string) (string, bool) {
+	hex, ok := ColorHex(text)
+	if !ok {
+		return "", false
+	}
+	value, err := strconv.ParseUint(hex[1:], 16, 32)
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("rgb(%d, %d, %d)", value>>16&0xff, value>>8&0xff, value&0xff), true
+}
+
+func (s *ClipboardManager) classActions(entry *db.ClipboardEntry) []*EntryAction {
+	text := strings.TrimSpace(string(entry.Data))
+	switch entry.Class {
+	case db.ClassURL:
+		if strings.HasPrefix(strings.ToLower(text), "www.") {
+			text = "http://" + text
+		}
+		return []*EntryAction{
+			{Label: "Open in browser", Run: func(*db.ClipboardEntry, string) error {
+				shellutils.Open(text)
+				return nil
+			}},
+		}
+	case db.ClassEmail:
+		if !strings.HasPrefix(strings.ToLower(text), "mailto:") {
+			text = "mailto:" + text
+		}
+		return []*EntryAction{
+			{Label: "Compose email", Run: func(*db.ClipboardEntry, string) error {
+				shellutils.Open(text)
+				return nil
+			}},
+		}
+	case db.ClassPath:
+		path := expandPath(text)
+		return []*EntryAction{
+			{Label: "Open in file manager", Run: func(*db.ClipboardEntry, string) error {
+				dir := path
+				if info, err := os.Stat(path); err == nil && !info.IsDir() {
+					dir = path[:strings.LastIndex(path, "/")+1]
+				}
+				shellutils.Open(dir)
+				return nil
+			}},
+			{Label: "Open file", Run: func(*db.ClipboardEntry, string) error {
+				shellutils.Open(path)
+				return nil
+			}},
+		}
+	case db.ClassColor:
+		var actions []*EntryAction
+		if hex, ok := ColorHex(text); ok && hex != text {
+			actions = append(actions, &EntryAction{Label: "Copy as " + hex, Run: func(*db.ClipboardEntry, string) error {
+				s.WriteText(hex)
+				return nil
+			}})
+		}
+		if rgb, ok := colorRGB(text); ok && rgb != text {
+			actions = append(actions, &EntryAction{Label: "Copy as " + rgb, Run: func(*db.ClipboardEntry, string) error {
+				s.WriteText(rgb)
+				return nil
+			}})
+		}
+		return actions
+	case db.ClassJSON:
+		return []*EntryAction{
+			{Label: "Copy pretty-printed", Run: func(entry *db.ClipboardEntry, _ string) error {
+				var out bytes.Buffer
+				if err := json.Indent(&out, bytes.TrimSpace(entry.Data), "", "  "); err != nil {
+					return err
+				}
+				s.WriteText(out.String())
+				return nil
+			}},
+			{Label: "Copy minified", Run: func(entry *db.ClipboardEntry, _ string) error {
+				var out bytes.Buffer
+				if err := json.Compact(&out, entry.Data); err != nil {
+					return err
+				}
+				s.WriteText(out.String())
+				return nil
+			}},
+		}
+	case db.ClassNumber:
+		if stripped := separatorRegex.ReplaceAllString(text, ""); stripped != text {
+			return []*EntryAction{
+				{Label: "Copy without separators", Run: func(*db.ClipboardEntry, string) error {
+					s.WriteText(stripped)
+					return nil
+				}},
+			}
+		}
+	case db.ClassCode:
+		return []*EntryAction{
+			{Label: "Copy without indentation", Run: func(entry *db.ClipboardEntry, _ string) error {
+				s.WriteText(dedent(string(entry.Data)))
+				return nil
+			}},
+			{Label: "Copy as Markdown code block", Run: func(entry *db.ClipboardEntry, _ string) error {
+				s.WriteText("```\n" + strings.Trim(dedent(string(entry.Data)), "\n") + "\n```")
+				return nil
+			}},
+		}
+	case db.ClassPhone:
+		number := nonDialRegex.ReplaceAllString(text, "")
+		return []*EntryAction{
+			{Label: "Call", Run: func(*db.ClipboardEntry, string) error {
+				shellutils.Open("tel:" + number)
+				return nil
+			}},
+		}
+	}
+	return nil
+}
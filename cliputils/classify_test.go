@@ -0,0 +1,40 @@
+package cliputils
+
+import (
+	"Goclip/db"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"https://example.com/a", db.ClassURL},
+		{"user@example.com", db.ClassEmail},
+		{"#fff", db.ClassColor},
+		{"#000000", db.ClassColor},
+		{"rgb(1, 2, 3)", db.ClassColor},
+		{"#123", db.ClassText},
+		{`{"a": 1}`, db.ClassJSON},
+		{"1234", db.ClassNumber},
+		{"-1234567", db.ClassNumber},
+		{"+1234567", db.ClassNumber},
+		{"1,234,567.89", db.ClassNumber},
+		{"1 000 000", db.ClassNumber},
+		{"12345678", db.ClassNumber},
+		{"2026-01-01", db.ClassText},
+		{"192.168.1.100", db.ClassText},
+		{"555-123-4567", db.ClassPhone},
+		{"(555) 123 4567", db.ClassPhone},
+		{"+33 6 12 34 56 78", db.ClassPhone},
+		{"555.123.4567", db.ClassPhone},
+		{"func main() {\n\treturn\n}", db.ClassCode},
+		{"just some words", db.ClassText},
+	}
+	for _, test := range tests {
+		if got := Classify("text/plain", []byte(test.text)); got != test.want {
+			t.Errorf("Classify(%q) = %s, want %s", test.text, got, test.want)
+		}
+	}
+}
@@ -1,18 +1,34 @@
 package cliputils
 
 import (
+	"Goclip/apputils"
 	"Goclip/db"
+	"Goclip/imgutils"
 	"Goclip/log"
+	"Goclip/scriptutils"
 	"Goclip/utils"
 	"context"
 	"github.com/go-vgo/robotgo"
 	"golang.design/x/clipboard"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
+// pasteDelay leaves the focused app the time to read the clipboard after a paste
+const pasteDelay = 200 * time.Millisecond
+
+// restoreDelay is longer than the clipboard polling, so that the restored content is not captured again
+const restoreDelay = 1500 * time.Millisecond
+
 type ClipboardManager struct {
-	db       db.GoclipDB
-	reloadCb func()
+	db        db.GoclipDB
+	scripts   *scriptutils.ScriptManager
+	apps      *apputils.AppManager
+	reloadCb  func()
+	mu        sync.Mutex
+	expanding bool
 }
 
 func NewClipboardManager(myDb db.GoclipDB) *ClipboardManager {
@@ -23,6 +39,14 @@ func (s *ClipboardManager) SetReloadHistoryCallback(f func()) {
 	s.reloadCb = f
 }
 
+func (s *ClipboardManager) SetScriptManager(scripts *scriptutils.ScriptManager) {
+	s.scripts = scripts
+}
+
+func (s *ClipboardManager) SetAppManager(apps *apputils.AppManager) {
+	s.apps = apps
+}
+
 func (s *ClipboardManager) StartListener() {
 	go s.startTextListener()
 	go s.startImageListener()
@@ -32,14 +56,7 @@ func (s *ClipboardManager) startTextListener() {
 	ch := clipboard.Watch(context.TODO(), clipboard.FmtText)
 	for data := range ch {
 		log.Info("Got text: ", string(data))
-		entry := &db.ClipboardEntry{
-			Md5:       utils.Md5Digest(data),
-			Mime:      "text/plain",
-			Data:      data,
-			Timestamp: time.Now(),
-		}
-		s.db.AddClipboardEntry(entry)
-		s.reloadCb()
+		s.capture(newEntry("text/plain", data))
 	}
 }
 
@@ -47,15 +64,145 @@ func (s *ClipboardManager) startImageListener() {
 	ch := clipboard.Watch(context.TODO(), clipboard.FmtImage)
 	for data := range ch {
 		log.Info("Got image: ", len(data))
-		entry := &db.ClipboardEntry{
-			Md5:       utils.Md5Digest(data),
-			Mime:      "image/png",
-			Data:      data,
-			Timestamp: time.Now(),
+		s.capture(newEntry(imgutils.MimePng, data))
+	}
+}
+
+func (s *ClipboardManager) isExpanding() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.expanding
+}
+
+func (s *ClipboardManager) setExpanding(expanding bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expanding = expanding
+}
+
+func (s *ClipboardManager) capture(entry *db.ClipboardEntry) {
+	// The snippet text pasted by the expander is not a copy of the user
+	if s.isExpanding() {
+		log.Info("Ignoring clipboard change during expansion")
+		return
+	}
+	if window, err := utils.ActiveWindow(); err == nil {
+		entry.SourceClass = window.Class
+		entry.SourceTitle = window.Title
+	} else {
+		log.Warning("Cannot get active window: ", err)
+	}
+	if entry = s.applyRules(entry); entry == nil {
+		return
+	}
+	if s.scripts != nil {
+		if entry = s.scripts.OnCopy(entry); entry == nil {
+			return
 		}
-		s.db.AddClipboardEntry(entry)
-		s.reloadCb()
+		entry.Class = Classify(entry.Mime, entry.Data)
+	}
+	s.addEntry(entry)
+}
+
+func newEntry(mime string, data []byte) *db.ClipboardEntry {
+	return &db.ClipboardEntry{
+		Md5:       utils.Md5Digest(data),
+		Mime:      mime,
+		Data:      data,
+		Timestamp: time.Now(),
+		Class:     Classify(mime, data),
+	}
+}
+
+func (s *ClipboardManager) settings() *db.Settings {
+	settings, err := s.db.GetSettings()
+	if err != nil {
+		return db.DefaultSettings()
+	}
+	if settings.TrackingParams == nil {
+		settings.TrackingParams = db.DefaultTrackingParams()
+	}
+	return settings
+}
+
+func (s *ClipboardManager) rewrite(entry *db.ClipboardEntry) {
+	if entry.Class != db.ClassURL {
+		return
+	}
+	settings := s.settings()
+	if !settings.StripTrackingParams {
+		return
+	}
+	text := strings.TrimSpace(string(entry.Data))
+	cleaned := StripTrackingParams(text, settings.TrackingParams)
+	if cleaned == text {
+		return
+	}
+	log.Info("Stripped tracking parameters: ", cleaned)
+	entry.Original = entry.Data
+	entry.Data = []byte(cleaned)
+	entry.Md5 = utils.Md5Digest(entry.Data)
+}
+
+func (s *ClipboardManager) addEntry(entry *db.ClipboardEntry) error {
+	s.rewrite(entry)
+	// Copying an entry again must not lose what we already know about it
+	if old, err := s.db.GetClipboardEntry(entry.Md5); err == nil {
+		// A known entry keeps its first capture, source and use count, copying it again only
+		// makes it recent: pasting it from the history is counted by markUsed, then captured here
+		entry.Timestamp = old.Timestamp
+		entry.LastUsed = time.Now()
+		entry.UseCount = old.UseCount
+		if old.SourceClass != "" || old.SourceTitle != "" {
+			entry.SourceClass = old.SourceClass
+			entry.SourceTitle = old.SourceTitle
+		}
+		entry.Starred = entry.Starred || old.Starred
+		for _, tag := range old.Tags {
+			if !entry.HasTag(tag) {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+		if entry.Original == nil {
+			entry.Original = old.Original
+		}
+		if entry.Collection == "" {
+			entry.Collection = old.Collection
+		}
+		if entry.Command == "" {
+			entry.Command = old.Command
+		}
+	}
+	if err := s.db.AddClipboardEntry(entry); err != nil {
+		return err
 	}
+	s.reloadCb()
+	return nil
+}
+
+func (s *ClipboardManager) SaveTransformedImage(entry *db.ClipboardEntry, transform func([]byte) ([]byte, string, error)) error {
+	data, mime, err := transform(entry.Data)
+	if err != nil {
+		log.Error("Error transforming image: ", err)
+		return err
+	}
+	return s.addEntry(newEntry(mime, data))
+}
+
+func (s *ClipboardManager) WriteTransformedImage(entry *db.ClipboardEntry, transform func([]byte) ([]byte, string, error)) error {
+	data, mime, err := transform(entry.Data)
+	if err != nil {
+		log.Error("Error transforming image: ", err)
+		return err
+	}
+	// The system clipboard only carries png images
+	if mime != imgutils.MimePng {
+		if data, _, err = imgutils.Convert(data, imgutils.MimePng); err != nil {
+			return err
+		}
+	}
+	s.WriteImage(data)
+	return nil
 }
 
 func (s *ClipboardManager) WriteText(text string) {
@@ -66,26 +213,102 @@ func (s *ClipboardManager) WriteImage(data []byte) {
 	clipboard.Write(clipboard.FmtImage, data)
 }
 
+func (s *ClipboardManager) ReadText() string {
+	return string(clipboard.Read(clipboard.FmtText))
+}
+
+// ReplaceTyped deletes the last erase typed characters, pastes text in their place and types
+// the delimiter again. The clipboard content is restored afterwards.
+func (s *ClipboardManager) ReplaceTyped(erase int, text string, cursorBack int, delimiter rune) {
+	s.setExpanding(true)
+	defer s.setExpanding(false)
+	savedText := clipboard.Read(clipboard.FmtText)
+	var savedImage []byte
+	if savedText == nil {
+		savedImage = clipboard.Read(clipboard.FmtImage)
+	}
+	for i := 0; i < erase; i++ {
+		robotgo.KeyTap("backspace")
+	}
+	s.WriteText(text)
+	time.Sleep(pasteDelay)
+	var keys []string
+	switch delimiter {
+	case ' ':
+		keys = append(keys, "space")
+	case '\t':
+		keys = append(keys, "tab")
+	}
+	if cursorBack > 0 {
+		cursorBack += len(keys)
+	}
+	s.paste(cursorBack, keys...)
+	time.Sleep(pasteDelay)
+	if savedText != nil {
+		s.WriteText(string(savedText))
+	} else if savedImage != nil {
+		s.WriteImage(savedImage)
+	}
+	time.Sleep(restoreDelay)
+}
+
 func (s *ClipboardManager) WriteEntry(entry *db.ClipboardEntry) {
+	s.markUsed(entry)
+	s.WriteEntryWithCursor(entry, 0)
+}
+
+// markUsed bumps the use count of a stored entry, moving it on top of the history
+func (s *ClipboardManager) markUsed(entry *db.ClipboardEntry) {
+	stored, err := s.db.GetClipboardEntry(entry.Md5)
+	if err != nil {
+		return
+	}
+	stored.UseCount++
+	stored.LastUsed = time.Now()
+	if err := s.db.AddClipboardEntry(stored); err != nil {
+		return
+	}
+	s.reloadCb()
+}
+
+// WriteEntryWithCursor pastes the entry, then moves the cursor cursorBack characters to the left.
+func (s *ClipboardManager) WriteEntryWithCursor(entry *db.ClipboardEntry, cursorBack int) {
 	if entry.IsText() {
 		log.Info("Writing text: ", string(entry.Data))
 		s.WriteText(string(entry.Data))
 		go func() {
-			time.Sleep(time.Millisecond * 200)
-			robotgo.KeyDown("ctrl")
-			robotgo.KeyDown("shift")
-			robotgo.KeyDown("v")
-			robotgo.KeyUp("v")
-			robotgo.KeyUp("shift")
-			robotgo.KeyUp("ctrl")
+			time.Sleep(pasteDelay)
+			s.paste(cursorBack)
 		}()
 	} else if entry.IsImage() {
-		clipboard.Write(clipboard.FmtImage, entry.Data)
+		if entry.Mime != imgutils.MimePng {
+			s.WriteTransformedImage(entry, func(data []byte) ([]byte, string, error) {
+				return data, entry.Mime, nil
+			})
+			return
+		}
+		s.WriteImage(entry.Data)
 	} else {
 		log.Warning("Warning: Invalid entry mimetype: ", entry.Mime)
 	}
 }
 
+// paste sends the paste shortcut, then taps keys and moves the cursor cursorBack characters to the left.
+func (s *ClipboardManager) paste(cursorBack int, keys ...string) {
+	robotgo.KeyDown("ctrl")
+	robotgo.KeyDown("shift")
+	robotgo.KeyDown("v")
+	robotgo.KeyUp("v")
+	robotgo.KeyUp("shift")
+	robotgo.KeyUp("ctrl")
+	for _, key := range keys {
+		robotgo.KeyTap(key)
+	}
+	for i := 0; i < cursorBack; i++ {
+		robotgo.KeyTap("left")
+	}
+}
+
 func (s *ClipboardManager) GetEntries() []*db.ClipboardEntry {
 	var newEntries []*db.ClipboardEntry
 	entries := s.db.GetClipboardEntries()
@@ -99,6 +322,36 @@ func (s *ClipboardManager) GetEntries() []*db.ClipboardEntry {
 	return newEntries
 }
 
+type SearchResult struct {
+	Entry     *db.ClipboardEntry
+	Score     int
+	Positions []int
+}
+
+// Search returns the entries matching a query, best first, see db.ParseClipboardQuery for the syntax.
+// An invalid query is searched as plain text.
+func (s *ClipboardManager) Search(text string) []*SearchResult {
+	query, err := db.ParseClipboardQuery(text)
+	if err != nil {
+		log.Warning("Invalid query: ", err)
+		query = &db.ClipboardQuery{Conditions: []*db.QueryCondition{{Field: db.QueryText, Value: text, Exact: true}}}
+	}
+	entries, _ := s.db.FindClipboardEntries(query)
+	var results []*SearchResult
+	for _, entry := range entries {
+		score, positions := query.Score(entry)
+		results = append(results, &SearchResult{
+			Entry:     entry,
+			Score:     score + utils.Frecency(entry.UseCount, entry.LastUsed),
+			Positions: positions,
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
+
 func (s *ClipboardManager) GetEntry(md5 string) (*db.ClipboardEntry, error) {
 	return s.db.GetClipboardEntry(md5)
 }
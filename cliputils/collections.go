@@ -0,0 +1,165 @@
+package cliputils
+
+import (
+	"Goclip/db"
+	"Goclip/log"
+	"Goclip/shellutils"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+type exportEntry struct {
+	Timestamp   time.Time
+	Mime        string
+	Class       string `json:",omitempty"`
+	Text        string `json:",omitempty"`
+	Data        []byte `json:",omitempty"`
+	Starred     bool
+	Tags        []string `json:",omitempty"`
+	Collection  string   `json:",omitempty"`
+	SourceClass string   `json:",omitempty"`
+	SourceTitle string   `json:",omitempty"`
+	UseCount    int
+	LastUsed    time.Time
+}
+
+func (s *ClipboardManager) SetTags(md5 string, tags []string) error {
+	entry, err := s.db.GetClipboardEntry(md5)
+	if err != nil {
+		return err
+	}
+	entry.Tags = tags
+	if err := s.db.AddClipboardEntry(entry); err != nil {
+		return err
+	}
+	s.reloadCb()
+	return nil
+}
+
+func (s *ClipboardManager) SetCollection(md5 string, collection string) error {
+	entry, err := s.db.GetClipboardEntry(md5)
+	if err != nil {
+		return err
+	}
+	entry.Collection = collection
+	if err := s.db.AddClipboardEntry(entry); err != nil {
+		return err
+	}
+	s.reloadCb()
+	return nil
+}
+
+func (s *ClipboardManager) GetCollections() []string {
+	found := map[string]bool{}
+	var collections []string
+	for _, entry := range s.db.GetClipboardEntries() {
+		if entry.Collection != "" && !found[entry.Collection] {
+			found[entry.Collection] = true
+			collections = append(collections, entry.Collection)
+		}
+	}
+	sort.Strings(collections)
+	return collections
+}
+
+func (s *ClipboardManager) ExportEntries(fn string, filter func(entry *db.ClipboardEntry) bool) (int, error) {
+	if path, err := shellutils.ExpandUserDir(fn); err == nil {
+		fn = path
+	}
+	var exported []*exportEntry
+	for _, entry := range s.db.GetClipboardEntries() {
+		if !filter(entry) {
+			continue
+		}
+		e := &exportEntry{
+			Timestamp:   entry.Timestamp,
+			Mime:        entry.Mime,
+			Class:       entry.Class,
+			Starred:     entry.Starred,
+			Tags:        entry.Tags,
+			Collection:  entry.Collection,
+			SourceClass: entry.SourceClass,
+			SourceTitle: entry.SourceTitle,
+			UseCount:    entry.UseCount,
+			LastUsed:    entry.LastUsed,
+		}
+		if entry.IsText() {
+			e.Text = string(entry.Data)
+		} else {
+			e.Data = entry.Data
+		}
+		exported = append(exported, e)
+	}
+	data, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		log.Error("Error exporting entries: ", err)
+		return 0, err
+	}
+	if err := ioutil.WriteFile(fn, data, 0600); err != nil {
+		log.Error("Error writing export file: ", err)
+		return 0, err
+	}
+	log.Info("Exported ", len(exported), " entries to ", fn)
+	return len(exported), nil
+}
+
+func (s *ClipboardManager) organizeActions(entry *db.ClipboardEntry) []*EntryAction {
+	actions := []*EntryAction{
+		{
+			Label:   "Edit tags...",
+			Prompt:  "Tags (comma separated):",
+			Default: strings.Join(entry.Tags, ", "),
+			Run: func(entry *db.ClipboardEntry, input string) error {
+				var tags []string
+				for _, tag := range strings.Split(input, ",") {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						tags = append(tags, tag)
+					}
+				}
+				return s.SetTags(entry.Md5, tags)
+			},
+		},
+		{
+			Label:   "Move to collection...",
+			Prompt:  "Collection (empty to remove):",
+			Default: entry.Collection,
+			Run: func(entry *db.ClipboardEntry, input string) error {
+				return s.SetCollection(entry.Md5, strings.TrimSpace(input))
+			},
+		},
+	}
+	if entry.Collection != "" {
+		collection := entry.Collection
+		actions = append(actions, &EntryAction{
+			Group:   "Export",
+			Label:   "Collection " + collection + "...",
+			Prompt:  "Export to file:",
+			Default: "~/goclip-" + collection + ".json",
+			Run: func(_ *db.ClipboardEntry, input string) error {
+				_, err := s.ExportEntries(input, func(entry *db.ClipboardEntry) bool {
+					return entry.Collection == collection
+				})
+				return err
+			},
+		})
+	}
+	for _, tag := range entry.Tags {
+		t := tag
+		actions = append(actions, &EntryAction{
+			Group:   "Export",
+			Label:   "Tag " + t + "...",
+			Prompt:  "Export to file:",
+			Default: "~/goclip-" + t + ".json",
+			Run: func(_ *db.ClipboardEntry, input string) error {
+				_, err := s.ExportEntries(input, func(entry *db.ClipboardEntry) bool {
+					return entry.HasTag(t)
+				})
+				return err
+			},
+		})
+	}
+	return actions
+}
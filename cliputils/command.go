@@ -0,0 +1,44 @@
+package cliputils
+
+import (
+	"Goclip/log"
+	"Goclip/shellutils"
+	"Goclip/utils"
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const captureTimeout = 30 * time.Second
+
+// CaptureCommand runs a shell command in the background, stores its output in the history
+// and copies it to the clipboard, then notifies its exit status
+func (s *ClipboardManager) CaptureCommand(command string) {
+	out, code, err := shellutils.Capture(command, captureTimeout)
+	out = bytes.TrimRight(out, "\n")
+	status := fmt.Sprintf("exit status %d", code)
+	if err != nil {
+		log.Error("Error running command: ", err)
+		status = err.Error()
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		shellutils.Notify(command, status+", no output")
+		return
+	}
+	entry := newEntry("text/plain", out)
+	entry.Command = command
+	entry.SourceClass = utils.AppName
+	entry.SourceTitle = command
+	if err := s.addEntry(entry); err != nil {
+		log.Error("Error saving command output: ", err)
+		shellutils.Notify(command, status+", cannot save the output")
+		return
+	}
+	s.WriteText(string(entry.Data))
+	body := fmt.Sprintf("%s, %d bytes copied", status, len(entry.Data))
+	if line := strings.SplitN(string(entry.Data), "\n", 2)[0]; len(line) <= 80 {
+		body += "\n" + line
+	}
+	shellutils.Notify(command, body)
+}
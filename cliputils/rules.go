@@ -0,0 +1,110 @@
+package cliputils
+
+import (
+	"Goclip/db"
+	"Goclip/log"
+	"Goclip/shellutils"
+	"Goclip/utils"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ruleCommandTimeout = 10 * time.Second
+
+func ruleMatches(rule *db.Rule, entry *db.ClipboardEntry) bool {
+	switch rule.Match {
+	case db.RuleMatchMime:
+		matched, err := path.Match(rule.Pattern, entry.Mime)
+		return err == nil && matched
+	case db.RuleMatchClass:
+		return strings.EqualFold(rule.Pattern, entry.Class)
+	case db.RuleMatchRegex:
+		if !entry.IsText() {
+			return false
+		}
+		r, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			log.Warning("Invalid rule regex: ", rule.Pattern, " - ", err)
+			return false
+		}
+		return r.Match(entry.Data)
+	case db.RuleMatchWindow:
+		r, err := regexp.Compile("(?i)" + rule.Pattern)
+		if err != nil {
+			log.Warning("Invalid rule regex: ", rule.Pattern, " - ", err)
+			return false
+		}
+		return r.MatchString(entry.SourceClass)
+	}
+	return false
+}
+
+func runRuleCommand(command string, data []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ruleCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = shellutils.LaunchEnv()
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = os.Stderr
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	err := shellutils.RunGroup(ctx, cmd)
+	return out.Bytes(), err
+}
+
+// applyRules runs the user defined rules against a new entry.
+// It returns nil when the entry must be dropped.
+func (s *ClipboardManager) applyRules(entry *db.ClipboardEntry) *db.ClipboardEntry {
+	for _, rule := range s.db.GetRules() {
+		if !rule.Enabled || !ruleMatches(rule, entry) {
+			continue
+		}
+		log.Info("Rule matched: ", rule.Match, " ", rule.Pattern, " -> ", rule.Action)
+		switch rule.Action {
+		case db.RuleActionDrop:
+			return nil
+		case db.RuleActionTransform:
+			out, err := runRuleCommand(rule.Arg, entry.Data)
+			if err != nil {
+				log.Error("Error running transform command: ", err)
+				continue
+			}
+			if entry.IsText() {
+				out = bytes.TrimSuffix(out, []byte("\n"))
+			}
+			entry.Data = out
+			entry.Md5 = utils.Md5Digest(out)
+			entry.Class = Classify(entry.Mime, out)
+		case db.RuleActionStar:
+			entry.Starred = true
+		case db.RuleActionTag:
+			for _, tag := range strings.Split(rule.Arg, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" && !entry.HasTag(tag) {
+					entry.Tags = append(entry.Tags, tag)
+				}
+			}
+		case db.RuleActionExpire:
+			minutes, err := strconv.Atoi(strings.TrimSpace(rule.Arg))
+			if err != nil {
+				log.Warning("Invalid expiration minutes: ", rule.Arg)
+				continue
+			}
+			entry.ExpiresAt = time.Now().Add(time.Duration(minutes) * time.Minute)
+		case db.RuleActionCommand:
+			data := entry.Data
+			go func(command string) {
+				if _, err := runRuleCommand(command, data); err != nil {
+					log.Error("Error running rule command: ", err)
+				}
+			}(rule.Arg)
+		}
+	}
+	return entry
+}
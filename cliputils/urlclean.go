@@ -0,0 +1,40 @@
+package cliputils
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+func isTrackingParam(key string, patterns []string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range patterns {
+		if matched, err := path.Match(strings.ToLower(pattern), key); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// StripTrackingParams removes the query parameters matching any of the glob
+// patterns, leaving the order and encoding of the remaining ones untouched.
+func StripTrackingParams(rawUrl string, patterns []string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.RawQuery == "" {
+		return rawUrl
+	}
+	var kept []string
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		key := strings.SplitN(param, "=", 2)[0]
+		if decoded, err := url.QueryUnescape(key); err == nil {
+			key = decoded
+		}
+		if param == "" || isTrackingParam(key, patterns) {
+			continue
+		}
+		kept = append(kept, param)
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	u.ForceQuery = false
+	return u.String()
+}
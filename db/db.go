@@ -5,12 +5,35 @@ import (
 	"time"
 )
 
+const (
+	ClassText   = "text"
+	ClassImage  = "image"
+	ClassURL    = "url"
+	ClassEmail  = "email"
+	ClassPath   = "path"
+	ClassColor  = "color"
+	ClassJSON   = "json"
+	ClassCode   = "code"
+	ClassNumber = "number"
+	ClassPhone  = "phone"
+)
+
 type ClipboardEntry struct {
-	Md5       string    `storm:"id"`
-	Timestamp time.Time `storm:"index"`
-	Mime      string
-	Data      []byte
-	Starred   bool
+	Md5         string    `storm:"id"`
+	Timestamp   time.Time `storm:"index"`
+	Mime        string
+	Data        []byte
+	Starred     bool
+	Class       string
+	Original    []byte
+	Tags        []string
+	Collection  string
+	ExpiresAt   time.Time
+	SourceClass string
+	SourceTitle string
+	UseCount    int
+	LastUsed    time.Time
+	Command     string
 }
 
 func (s *ClipboardEntry) IsText() bool {
@@ -21,34 +44,188 @@ func (s *ClipboardEntry) IsImage() bool {
 	return strings.Contains(s.Mime, "image")
 }
 
+func (s *ClipboardEntry) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsKept tells whether the entry is exempt from the history cleanup
+func (s *ClipboardEntry) IsKept() bool {
+	return s.Starred || len(s.Tags) > 0 || s.Collection != ""
+}
+
+// LastActivity is the latest between the first capture and the last time the entry was used
+func (s *ClipboardEntry) LastActivity() time.Time {
+	if s.LastUsed.After(s.Timestamp) {
+		return s.LastUsed
+	}
+	return s.Timestamp
+}
+
+func (s *ClipboardEntry) IsExpired() bool {
+	return !s.ExpiresAt.IsZero() && s.ExpiresAt.Before(time.Now())
+}
+
 type AppEntry struct {
-	Exec       string `storm:"id"`
-	File       string
-	Name       string
-	Icon       string
-	Terminal   bool
-	AccessTime time.Time `storm:"index"`
+	Id          string `storm:"id"`
+	Exec        string
+	File        string
+	Type        string
+	Name        string
+	GenericName string
+	Comment     string
+	Keywords    []string
+	Categories  []string
+	MimeTypes   []string
+	URL         string
+	Icon        string
+	Path        string
+	Terminal    bool
+	Actions     []*AppAction
+	AccessTime  time.Time `storm:"index"`
+	LaunchCount int
+	Frecency    float64
+}
+
+// AppAction is an additional way to launch an app, from a [Desktop Action id] group
+type AppAction struct {
+	Id   string
+	Name string
+	Exec string
+	Icon string
+}
+
+// CustomApp is a launcher entry defined by the user, without a desktop file
+type CustomApp struct {
+	Id       int `storm:"id,increment"`
+	Name     string
+	Command  string
+	Icon     string
+	Path     string
+	Terminal bool
+	Keywords []string
+}
+
+// AppOverride hides, renames or changes the icon of an app, by app Id
+type AppOverride struct {
+	AppId  string `storm:"id"`
+	Hidden bool
+	Name   string
+	Icon   string
 }
 
 type ShellEntry struct {
 	Cmd       string `storm:"id"`
 	IsHistory bool
 	IsShell   bool
+	Count     int
+	LastUsed  time.Time
+	Index     int
+}
+
+const (
+	CommandSourceShell   = "shell"
+	CommandSourceApp     = "app"
+	CommandSourceCapture = "capture"
+	CommandSourceOpen    = "open"
+)
+
+// CommandRecord is a command launched by Goclip. ExitCode is -1 while the command runs,
+// or when it could not start or was killed.
+type CommandRecord struct {
+	Id       int `storm:"id,increment"`
+	Source   string
+	Command  string
+	Args     []string
+	AppId    string
+	Dir      string
+	Terminal bool
+	Start    time.Time `storm:"index"`
+	Duration time.Duration
+	Running  bool
+	ExitCode int
+	Error    string
+	Output   string
+}
+
+type Snippet struct {
+	Name  string `storm:"id"`
+	Alias string `storm:"index"`
+	Body  string
+	Tags  []string
+}
+
+const (
+	RuleMatchMime   = "mime"
+	RuleMatchClass  = "class"
+	RuleMatchRegex  = "regex"
+	RuleMatchWindow = "window"
+)
+
+const (
+	RuleActionDrop      = "drop"
+	RuleActionTransform = "transform"
+	RuleActionStar      = "star"
+	RuleActionTag       = "tag"
+	RuleActionExpire    = "expire"
+	RuleActionCommand   = "command"
+)
+
+var RuleMatchers = []string{RuleMatchMime, RuleMatchClass, RuleMatchRegex, RuleMatchWindow}
+var RuleActions = []string{RuleActionDrop, RuleActionTransform, RuleActionStar, RuleActionTag, RuleActionExpire, RuleActionCommand}
+
+type Rule struct {
+	Id      int `storm:"id,increment"`
+	Match   string
+	Pattern string
+	Action  string
+	Arg     string
+	Enabled bool
+}
+
+// EnvOverride sets a variable in the environment of the launched apps matching App:
+// a desktop file ID, a command name or * for all of them. An empty Value unsets the variable.
+type EnvOverride struct {
+	Id    int `storm:"id,increment"`
+	App   string
+	Name  string
+	Value string
 }
 
 type Settings struct {
-	MaxEntries        int
-	ClipboardShortcut string
-	AppsShortcut      string
-	ShellShortcut     string
+	MaxEntries          int
+	ClipboardShortcut   string
+	AppsShortcut        string
+	ShellShortcut       string
+	StripTrackingParams bool
+	TrackingParams      []string
+	ExpanderDisabled    bool // inverted, so that it is off in the settings saved before it existed
+	ExpanderExcluded    []string
+	PathInTerminal      bool
+	Terminal            string
+	TerminalTemplate    string
+}
+
+func DefaultTrackingParams() []string {
+	return []string{
+		"utm_*", "fbclid", "gclid", "dclid", "gbraid", "wbraid", "msclkid", "yclid", "twclid", "ttclid",
+		"igshid", "mc_cid", "mc_eid", "_ga", "_gl", "_hsenc", "_hsmi", "mkt_tok", "vero_id", "oly_anon_id",
+		"oly_enc_id", "rb_clickid", "s_cid", "wickedid", "ref_src",
+	}
 }
 
 func DefaultSettings() *Settings {
 	return &Settings{
-		MaxEntries:        100,
-		ClipboardShortcut: "alt+v",
-		AppsShortcut:      "alt+c",
-		ShellShortcut:     "alt+x",
+		MaxEntries:          100,
+		ClipboardShortcut:   "alt+v",
+		AppsShortcut:        "alt+c",
+		ShellShortcut:       "alt+x",
+		StripTrackingParams: false,
+		TrackingParams:      DefaultTrackingParams(),
 	}
 }
 
@@ -57,21 +234,45 @@ type GoclipDB interface {
 	DeleteClipboardEntry(md5 string) error
 	GetClipboardEntry(md5 string) (*ClipboardEntry, error)
 	GetClipboardEntries() []*ClipboardEntry
+	FindClipboardEntries(query *ClipboardQuery) ([]*ClipboardEntry, error)
 
 	AddAppEntries([]*AppEntry) error
 	GetAppEntries() []*AppEntry
-	GetAppEntry(cmd string) (*AppEntry, error)
-	UpdateAppEntry(entry *AppEntry)
+	GetAppEntry(id string) (*AppEntry, error)
+	SaveAppEntry(entry *AppEntry)
+
+	GetCustomApps() []*CustomApp
+	SaveCustomApp(app *CustomApp) error
+	DeleteCustomApp(id int) error
+	GetAppOverrides() []*AppOverride
+	SaveAppOverride(override *AppOverride) error
+	DeleteAppOverride(appId string) error
 
 	AddShellEntries([]*ShellEntry) error
 	GetShellEntries(cmd string, limit int) ([]*ShellEntry, error)
 
+	SaveCommandRecord(record *CommandRecord) error
+	GetCommandRecords(limit int) []*CommandRecord
+
+	SaveSnippet(snippet *Snippet) error
+	DeleteSnippet(name string) error
+	GetSnippets() []*Snippet
+
 	GetSettings() (*Settings, error)
 	SaveSettings(settings *Settings) error
 
+	GetRules() []*Rule
+	SaveRule(rule *Rule) error
+	DeleteRule(id int) error
+
+	GetEnvOverrides() []*EnvOverride
+	SaveEnvOverride(override *EnvOverride) error
+	DeleteEnvOverride(id int) error
+
 	DropAll() error
 	DropSettings() error
 	DropClipboard() error
 	DropApps() error
 	DropShell() error
+	DropSnippets() error
 }
@@ -0,0 +1,345 @@
+package db
+
+import (
+	"Goclip/utils"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	QueryText       = "text"
+	QueryRegex      = "regex"
+	QueryType       = "type"
+	QueryIs         = "is"
+	QueryTag        = "tag"
+	QueryCollection = "collection"
+	QueryFrom       = "from"
+	QueryAfter      = "after"
+	QueryBefore     = "before"
+	QueryOn         = "on"
+	QuerySize       = "size"
+)
+
+var queryAliases = map[string]string{
+	"col":  QueryCollection,
+	"date": QueryOn,
+}
+
+var sizeRegex = regexp.MustCompile(`^(<=|>=|<|>|=)?(\d+(?:\.\d+)?)([bkmg]?)$`)
+var relativeTimeRegex = regexp.MustCompile(`^(\d+)([mhdw])$`)
+
+// QueryCondition is a single term of a clipboard query, e.g. tag:work or -"some phrase"
+type QueryCondition struct {
+	Field  string
+	Value  string
+	Negate bool
+	Exact  bool
+	Op     string
+	Size   int64
+	From   time.Time
+	To     time.Time
+	regex  *regexp.Regexp
+}
+
+// ClipboardQuery matches the entries satisfying all of its conditions
+type ClipboardQuery struct {
+	Conditions []*QueryCondition
+}
+
+func (s *ClipboardQuery) IsEmpty() bool {
+	return len(s.Conditions) == 0
+}
+
+func (s *ClipboardQuery) Match(entry *ClipboardEntry) bool {
+	for _, cond := range s.Conditions {
+		if cond.Match(entry) == cond.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Score ranks an entry matching the query by how well its text matches the text conditions,
+// positions are the matched rune positions in the entry text.
+func (s *ClipboardQuery) Score(entry *ClipboardEntry) (int, []int) {
+	score := 0
+	var positions []int
+	if !entry.IsText() {
+		return score, positions
+	}
+	text := string(entry.Data)
+	for _, cond := range s.Conditions {
+		if cond.Field != QueryText || cond.Negate {
+			continue
+		}
+		if condScore, condPositions, ok := utils.FuzzyMatch(cond.Value, text); ok {
+			score += condScore
+			positions = append(positions, condPositions...)
+		}
+	}
+	return score, positions
+}
+
+func (s *QueryCondition) Match(entry *ClipboardEntry) bool {
+	switch s.Field {
+	case QueryText:
+		if !entry.IsText() {
+			return false
+		}
+		if s.Exact {
+			return strings.Contains(strings.ToLower(string(entry.Data)), strings.ToLower(s.Value))
+		}
+		_, _, ok := utils.FuzzyMatch(s.Value, string(entry.Data))
+		return ok
+	case QueryRegex:
+		return entry.IsText() && s.regex.Match(entry.Data)
+	case QueryType:
+		switch {
+		case strings.EqualFold(s.Value, ClassText):
+			return entry.IsText()
+		case strings.EqualFold(s.Value, ClassImage):
+			return entry.IsImage()
+		case strings.Contains(s.Value, "/"):
+			matched, err := path.Match(s.Value, entry.Mime)
+			return err == nil && matched
+		}
+		return strings.EqualFold(s.Value, entry.Class)
+	case QueryIs:
+		switch strings.ToLower(s.Value) {
+		case "starred":
+			return entry.Starred
+		case "tagged":
+			return len(entry.Tags) > 0
+		case "used":
+			return entry.UseCount > 0
+		case "expiring":
+			return !entry.ExpiresAt.IsZero()
+		}
+	case QueryTag:
+		return entry.HasTag(s.Value)
+	case QueryCollection:
+		return strings.EqualFold(entry.Collection, s.Value)
+	case QueryFrom:
+		value := strings.ToLower(s.Value)
+		return strings.Contains(strings.ToLower(entry.SourceClass), value) ||
+			strings.Contains(strings.ToLower(entry.SourceTitle), value)
+	case QueryAfter:
+		return !entry.Timestamp.Before(s.From)
+	case QueryBefore:
+		return entry.Timestamp.Before(s.From)
+	case QueryOn:
+		return !entry.Timestamp.Before(s.From) && entry.Timestamp.Before(s.To)
+	case QuerySize:
+		size := int64(len(entry.Data))
+		switch s.Op {
+		case "<":
+			return size < s.Size
+		case "<=":
+			return size <= s.Size
+		case ">":
+			return size > s.Size
+		case ">=":
+			return size >= s.Size
+		}
+		return size == s.Size
+	}
+	return false
+}
+
+// ParseClipboardQuery parses a search text like
+//
+//	type:image from:firefox after:2026-01-01 size:>1k -is:starred /^https?:/ "some phrase"
+//
+// Words without a known operator fuzzy match the entry text, quoted phrases must appear as they are.
+func ParseClipboardQuery(text string) (*ClipboardQuery, error) {
+	return parseClipboardQuery(text, time.Now())
+}
+
+func parseClipboardQuery(text string, now time.Time) (*ClipboardQuery, error) {
+	query := &ClipboardQuery{}
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		cond := &QueryCondition{}
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			cond.Negate = true
+			i++
+		}
+		if runes[i] == '/' {
+			if end := indexRune(runes, '/', i+1); end > i+1 {
+				regex, err := regexp.Compile(string(runes[i+1 : end]))
+				if err != nil {
+					return nil, fmt.Errorf("invalid regex %s: %v", string(runes[i:end+1]), err)
+				}
+				cond.Field = QueryRegex
+				cond.Value = string(runes[i+1 : end])
+				cond.regex = regex
+				query.Conditions = append(query.Conditions, cond)
+				i = end + 1
+				continue
+			}
+		}
+		var word []rune
+		quoted := runes[i] == '"'
+		for i < len(runes) && !unicode.IsSpace(runes[i]) {
+			if runes[i] == '"' {
+				end := indexRune(runes, '"', i+1)
+				if end < 0 {
+					end = len(runes)
+				}
+				word = append(word, runes[i+1:end]...)
+				i = end + 1
+				continue
+			}
+			word = append(word, runes[i])
+			i++
+		}
+		cond.Field = QueryText
+		cond.Value = string(word)
+		cond.Exact = quoted
+		if !quoted {
+			if idx := strings.Index(cond.Value, ":"); idx > 0 {
+				field := strings.ToLower(cond.Value[:idx])
+				if alias, found := queryAliases[field]; found {
+					field = alias
+				}
+				if isQueryField(field) {
+					cond.Field = field
+					cond.Value = cond.Value[idx+1:]
+					if err := cond.parseValue(now); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		if cond.Value != "" {
+			query.Conditions = append(query.Conditions, cond)
+		}
+	}
+	return query, nil
+}
+
+func indexRune(runes []rune, r rune, from int) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+func isQueryField(field string) bool {
+	switch field {
+	case QueryType, QueryIs, QueryTag, QueryCollection, QueryFrom, QueryAfter, QueryBefore, QueryOn, QuerySize:
+		return true
+	}
+	return false
+}
+
+func (s *QueryCondition) parseValue(now time.Time) error {
+	var err error
+	switch s.Field {
+	case QueryAfter, QueryBefore, QueryOn:
+		s.From, s.To, err = parseQueryTime(s.Value, now)
+		if err != nil {
+			return fmt.Errorf("invalid %s date %q: %v", s.Field, s.Value, err)
+		}
+	case QuerySize:
+		s.Op, s.Size, err = parseQuerySize(s.Value)
+		if err != nil {
+			return fmt.Errorf("invalid size %q: %v", s.Value, err)
+		}
+	case QueryIs:
+		switch strings.ToLower(s.Value) {
+		case "starred", "tagged", "used", "expiring":
+		default:
+			return fmt.Errorf("unknown is: value %q", s.Value)
+		}
+	}
+	return nil
+}
+
+func parseQuerySize(value string) (string, int64, error) {
+	m := sizeRegex.FindStringSubmatch(strings.ToLower(value))
+	if m == nil {
+		return "", 0, errors.New("expected e.g. >1k, <=2m or 512")
+	}
+	n, err := strconv.ParseFloat(m[2], 64)
+	if err != nil {
+		return "", 0, err
+	}
+	switch m[3] {
+	case "k":
+		n *= 1 << 10
+	case "m":
+		n *= 1 << 20
+	case "g":
+		n *= 1 << 30
+	}
+	op := m[1]
+	if op == "" {
+		op = "="
+	}
+	return op, int64(n), nil
+}
+
+// parseQueryTime returns the time range described by value: a date (2026-01-31), a date
+// and time (2026-01-31T15:04), today, yesterday, a weekday (the last one before today)
+// or a relative time (30m, 2h, 3d, 1w ago).
+func parseQueryTime(value string, now time.Time) (time.Time, time.Time, error) {
+	value = strings.ToLower(value)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	day := func(t time.Time) (time.Time, time.Time, error) {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+	switch value {
+	case "today":
+		return day(today)
+	case "yesterday":
+		return day(today.AddDate(0, 0, -1))
+	}
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		name := strings.ToLower(wd.String())
+		if value == name || value == name[:3] {
+			diff := (int(today.Weekday()) - int(wd) + 7) % 7
+			if diff == 0 {
+				diff = 7
+			}
+			return day(today.AddDate(0, 0, -diff))
+		}
+	}
+	if m := relativeTimeRegex.FindStringSubmatch(value); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		var unit time.Duration
+		switch m[2] {
+		case "m":
+			unit = time.Minute
+		case "h":
+			unit = time.Hour
+		case "d":
+			unit = 24 * time.Hour
+		case "w":
+			unit = 7 * 24 * time.Hour
+		}
+		return now.Add(-time.Duration(n) * unit), now, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02t15:04", value, now.Location()); err == nil {
+		return t, t.Add(time.Minute), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return day(t)
+	}
+	if t, err := time.ParseInLocation("2006-01", value, now.Location()); err == nil {
+		return t, t.AddDate(0, 1, 0), nil
+	}
+	return time.Time{}, time.Time{}, errors.New("expected e.g. 2026-01-31, today, tuesday or 3d")
+}
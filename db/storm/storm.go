@@ -3,15 +3,19 @@ package storm
 import (
 	"Goclip/db"
 	"Goclip/log"
+	"Goclip/utils"
 	"github.com/asdine/storm/v3"
 	"github.com/asdine/storm/v3/codec/protobuf"
 	"github.com/asdine/storm/v3/q"
 	"os"
 	"path/filepath"
-	"strings"
+	"sort"
 	"time"
 )
 
+// expireInterval is how often the expired clipboard entries are deleted
+const expireInterval = time.Minute
+
 type GoclipDBStorm struct {
 	clipDb  *storm.DB
 	appDb   *storm.DB
@@ -40,12 +44,15 @@ func New(dbDir string) (db.GoclipDB, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &GoclipDBStorm{
+	s := &GoclipDBStorm{
 		clipDb:  clipDb,
 		appDb:   appDb,
 		shellDb: shellDb,
 		setsDb:  setsDb,
-	}, nil
+	}
+	s.finishStaleRecords()
+	go s.expireLoop()
+	return s, nil
 }
 
 func openDb(fn string) (*storm.DB, error) {
@@ -57,6 +64,21 @@ func openDb(fn string) (*storm.DB, error) {
 	return myDb, nil
 }
 
+func (s *GoclipDBStorm) expireLoop() {
+	for {
+		s.deleteExpired()
+		time.Sleep(expireInterval)
+	}
+}
+
+// deleteExpired deletes the clipboard entries past their expiration time
+func (s *GoclipDBStorm) deleteExpired() {
+	query := s.clipDb.Select(q.Gt("ExpiresAt", time.Time{}), q.Lt("ExpiresAt", time.Now()))
+	if err := query.Delete(new(db.ClipboardEntry)); err != nil && err != storm.ErrNotFound {
+		log.Error("Error deleting expired entries: ", err)
+	}
+}
+
 func (s *GoclipDBStorm) cleanup() error {
 	settings, err := s.GetSettings()
 	if err != nil {
@@ -69,22 +91,36 @@ func (s *GoclipDBStorm) cleanup() error {
 		log.Error("Error getting db count: ", err)
 		return err
 	}
-	if tot > settings.MaxEntries {
-		n := tot - settings.MaxEntries
-		log.Info("Deleting ", n, " entries.")
-		var toDel []*db.ClipboardEntry
-		if err := s.clipDb.AllByIndex("Timestamp", &toDel, storm.Limit(n)); err != nil {
-			log.Error("Error getting db entries:", err)
-			return err
+	if tot <= settings.MaxEntries {
+		return nil
+	}
+	var oldest []*db.ClipboardEntry
+	if err := s.clipDb.AllByIndex("Timestamp", &oldest); err != nil {
+		log.Error("Error getting db entries:", err)
+		return err
+	}
+	// Kept entries do not count against the maximum
+	var unkept []*db.ClipboardEntry
+	for _, entry := range oldest {
+		if !entry.IsKept() {
+			unkept = append(unkept, entry)
 		}
-		for _, entry := range toDel {
-			// log.Println("Deleting:", entry.Data)
-			if err := s.clipDb.DeleteStruct(entry); err != nil {
-				log.Error("Error deleting db entry: ", err)
-			}
+	}
+	if len(unkept) <= settings.MaxEntries {
+		return nil
+	}
+	sort.SliceStable(unkept, func(i, j int) bool {
+		return unkept[i].LastActivity().Before(unkept[j].LastActivity())
+	})
+	n := len(unkept) - settings.MaxEntries
+	log.Info("Deleting ", n, " entries.")
+	for _, entry := range unkept[:n] {
+		// log.Println("Deleting:", entry.Data)
+		if err := s.clipDb.DeleteStruct(entry); err != nil {
+			log.Error("Error deleting db entry: ", err)
 		}
-		log.Info("Db cleanup complete.")
 	}
+	log.Info("Db cleanup complete.")
 	return nil
 }
 
@@ -108,7 +144,9 @@ func (s *GoclipDBStorm) DeleteClipboardEntry(md5 string) error {
 func (s *GoclipDBStorm) GetClipboardEntry(md5 string) (*db.ClipboardEntry, error) {
 	entry := db.ClipboardEntry{}
 	if err := s.clipDb.One("Md5", md5, &entry); err != nil {
-		log.Error("Error getting db entry:", err)
+		if err != storm.ErrNotFound {
+			log.Error("Error getting db entry:", err)
+		}
 		return nil, err
 	}
 	return &entry, nil
@@ -119,7 +157,72 @@ func (s *GoclipDBStorm) GetClipboardEntries() []*db.ClipboardEntry {
 	if err := s.clipDb.AllByIndex("Timestamp", &entries, storm.Reverse()); err != nil {
 		log.Error("Error getting db entries: ", err)
 	}
-	return entries
+	return sortClipboardEntries(entries)
+}
+
+// sortClipboardEntries removes the expired entries and sorts the others by last activity
+func sortClipboardEntries(entries []*db.ClipboardEntry) []*db.ClipboardEntry {
+	var valid []*db.ClipboardEntry
+	for _, entry := range entries {
+		if !entry.IsExpired() {
+			valid = append(valid, entry)
+		}
+	}
+	sort.SliceStable(valid, func(i, j int) bool {
+		return valid[i].LastActivity().After(valid[j].LastActivity())
+	})
+	return valid
+}
+
+type clipboardMatcher struct {
+	query *db.ClipboardQuery
+}
+
+// Match is given the entry by value by storm's Select
+func (s *clipboardMatcher) Match(i interface{}) (bool, error) {
+	switch entry := i.(type) {
+	case db.ClipboardEntry:
+		return s.query.Match(&entry), nil
+	case *db.ClipboardEntry:
+		return s.query.Match(entry), nil
+	}
+	return false, nil
+}
+
+func (s *GoclipDBStorm) FindClipboardEntries(query *db.ClipboardQuery) ([]*db.ClipboardEntry, error) {
+	var entries []*db.ClipboardEntry
+	if err := s.clipDb.Select(&clipboardMatcher{query: query}).Find(&entries); err != nil {
+		if err == storm.ErrNotFound {
+			return nil, nil
+		}
+		log.Error("Error finding db entries: ", err)
+		return nil, err
+	}
+	return sortClipboardEntries(entries), nil
+}
+
+func (s *GoclipDBStorm) SaveSnippet(snippet *db.Snippet) error {
+	if err := s.clipDb.Save(snippet); err != nil {
+		log.Error("Error saving snippet: ", err)
+		return err
+	}
+	return nil
+}
+
+func (s *GoclipDBStorm) DeleteSnippet(name string) error {
+	if err := s.clipDb.DeleteStruct(&db.Snippet{Name: name}); err != nil {
+		log.Error("Error deleting snippet: ", err)
+		return err
+	}
+	return nil
+}
+
+func (s *GoclipDBStorm) GetSnippets() []*db.Snippet {
+	var snippets []*db.Snippet
+	if err := s.clipDb.All(&snippets); err != nil {
+		log.Error("Error getting snippets: ", err)
+	}
+	return snippets
 }
 
 func (s *GoclipDBStorm) SaveSettings(settings *db.Settings) error {
@@ -139,11 +242,119 @@ func (s *GoclipDBStorm) GetSettings() (*db.Settings, error) {
 	return &settings, nil
 }
 
+func (s *GoclipDBStorm) GetRules() []*db.Rule {
+	var rules []*db.Rule
+	if err := s.setsDb.All(&rules); err != nil {
+		log.Error("Error getting rules: ", err)
+	}
+	return rules
+}
+
+func (s *GoclipDBStorm) SaveRule(rule *db.Rule) error {
+	if err := s.setsDb.Save(rule); err != nil {
+		log.Error("Error saving rule: ", err)
+		return err
+	}
+	return nil
+}
+
+func (s *GoclipDBStorm) DeleteRule(id int) error {
+	if err := s.setsDb.DeleteStruct(&db.Rule{Id: id}); err != nil {
+		log.Error("Error deleting rule: ", err)
+		return err
+	}
+	return nil
+}
+
+func (s *GoclipDBStorm) GetCustomApps() []*db.CustomApp {
+	var apps []*db.CustomApp
+	if err := s.setsDb.All(&apps); err != nil {
+		log.Error("Error getting custom apps: ", err)
+	}
+	return apps
+}
+
+func (s *GoclipDBStorm) SaveCustomApp(app *db.CustomApp) error {
+	if err := s.setsDb.Save(app); err != nil {
+		log.Error("Error saving custom app: ", err)
+		return err
+	}
+	return nil
+}
+
+func (s *GoclipDBStorm) DeleteCustomApp(id int) error {
+	if err := s.setsDb.DeleteStruct(&db.CustomApp{Id: id}); err != nil {
+		log.Error("Error deleting custom app: ", err)
+		return err
+	}
+	return nil
+}
+
+func (s *GoclipDBStorm) GetAppOverrides() []*db.AppOverride {
+	var overrides []*db.AppOverride
+	if err := s.setsDb.All(&overrides); err != nil {
+		log.Error("Error getting app overrides: ", err)
+	}
+	return overrides
+}
+
+func (s *GoclipDBStorm) SaveAppOverride(override *db.AppOverride) error {
+	if err := s.setsDb.Save(override); err != nil {
+		log.Error("Error saving app override: ", err)
+		return err
+	}
+	return nil
+}
+
+func (s *GoclipDBStorm) DeleteAppOverride(appId string) error {
+	if err := s.setsDb.DeleteStruct(&db.AppOverride{AppId: appId}); err != nil {
+		log.Error("Error deleting app override: ", err)
+		return err
+	}
+	return nil
+}
+
+func (s *GoclipDBStorm) GetEnvOverrides() []*db.EnvOverride {
+	var overrides []*db.EnvOverride
+	if err := s.setsDb.All(&overrides); err != nil {
+		log.Error("Error getting environment overrides: ", err)
+	}
+	return overrides
+}
+
+func (s *GoclipDBStorm) SaveEnvOverride(override *db.EnvOverride) error {
+	if err := s.setsDb.Save(override); err != nil {
+		log.Error("Error saving environment override: ", err)
+		return err
+	}
+	return nil
+}
+
+func (s *GoclipDBStorm) DeleteEnvOverride(id int) error {
+	if err := s.setsDb.DeleteStruct(&db.EnvOverride{Id: id}); err != nil {
+		log.Error("Error deleting environment override: ", err)
+		return err
+	}
+	return nil
+}
+
 func (s *GoclipDBStorm) DropSettings() error {
 	log.Info("Dropping settings...")
 	if err := s.setsDb.Drop("settings"); err != nil {
 		log.Error("Error dropping settings: ", err)
 	}
+	if err := s.setsDb.Drop(&db.Rule{}); err != nil {
+		log.Error("Error dropping rules: ", err)
+	}
+	if err := s.setsDb.Drop(&db.EnvOverride{}); err != nil {
+		log.Error("Error dropping environment overrides: ", err)
+	}
+	if err := s.setsDb.Drop(&db.CustomApp{}); err != nil {
+		log.Error("Error dropping custom apps: ", err)
+	}
+	if err := s.setsDb.Drop(&db.AppOverride{}); err != nil {
+		log.Error("Error dropping app overrides: ", err)
+	}
 	return nil
 }
 
@@ -168,6 +379,17 @@ func (s *GoclipDBStorm) DropShell() error {
 	if err := s.shellDb.Drop(&db.ShellEntry{}); err != nil {
 		log.Error("Error dropping shell history: ", err)
 	}
+	if err := s.shellDb.Drop(&db.CommandRecord{}); err != nil {
+		log.Error("Error dropping command records: ", err)
+	}
+	return nil
+}
+
+func (s *GoclipDBStorm) DropSnippets() error {
+	log.Info("Dropping snippets...")
+	if err := s.clipDb.Drop(&db.Snippet{}); err != nil {
+		log.Error("Error dropping snippets: ", err)
+	}
 	return nil
 }
 
@@ -182,21 +404,15 @@ func (s *GoclipDBStorm) DropAll() error {
 	if err := s.DropShell(); err != nil {
 		return err
 	}
+	if err := s.DropSnippets(); err != nil {
+		return err
+	}
 	if err := s.DropSettings(); err != nil {
 		return err
 	}
 	return nil
 }
 
-func appEntriesContain(entries []*db.AppEntry, entry *db.AppEntry) bool {
-	for i := range entries {
-		if entries[i].Exec == entry.Exec {
-			return true
-		}
-	}
-	return false
-}
-
 func (s *GoclipDBStorm) AddAppEntries(newEntries []*db.AppEntry) error {
 	log.Info("Removing old apps...")
 	tx, err := s.appDb.Begin(true)
@@ -204,21 +420,44 @@ func (s *GoclipDBStorm) AddAppEntries(newEntries []*db.AppEntry) error {
 		log.Error("Cannot start transaction: ", err)
 		return err
 	}
+	newIds := map[string]bool{}
+	for i := range newEntries {
+		newIds[newEntries[i].Id] = true
+	}
 	removed := 0
 	var oldEntries []*db.AppEntry
 	if err := tx.All(&oldEntries); err != nil {
 		log.Warning("Cannot get old entries: ", err)
 	}
-	var toExclude []*db.AppEntry
+	// Entries used to be keyed by Exec, they are dropped and their usage copied by file
+	migrate := false
+	for i := range oldEntries {
+		if oldEntries[i].Id == "" {
+			migrate = true
+			break
+		}
+	}
+	if migrate {
+		log.Info("Migrating apps to desktop file ids...")
+		if err := tx.Drop(&db.AppEntry{}); err != nil {
+			log.Warning("Cannot drop old entries: ", err)
+		}
+	}
+	oldById := map[string]*db.AppEntry{}
+	oldByFile := map[string]*db.AppEntry{}
 	for i := range oldEntries {
-		if !appEntriesContain(newEntries, oldEntries[i]) {
+		oldByFile[oldEntries[i].File] = oldEntries[i]
+		if migrate {
+			continue
+		}
+		if !newIds[oldEntries[i].Id] {
 			if err := tx.DeleteStruct(oldEntries[i]); err != nil {
 				log.Warning("Cannot delete old entry: ", err)
 			} else {
 				removed++
 			}
 		} else {
-			toExclude = append(toExclude, oldEntries[i])
+			oldById[oldEntries[i].Id] = oldEntries[i]
 		}
 	}
 	log.Info("Old apps removed: ", removed)
@@ -226,15 +465,24 @@ func (s *GoclipDBStorm) AddAppEntries(newEntries []*db.AppEntry) error {
 	log.Info("Adding new apps...")
 	added := 0
 	for i := range newEntries {
-		if !appEntriesContain(toExclude, newEntries[i]) {
-			log.Info("New:", newEntries[i].Exec)
-			if err := tx.Save(newEntries[i]); err != nil {
-				log.Error("Cannot save entry, aborting: ", err)
-				tx.Rollback()
-				return err
-			}
+		// Desktop file fields are refreshed, usage is kept
+		old, found := oldById[newEntries[i].Id]
+		if !found {
+			old, found = oldByFile[newEntries[i].File]
+		}
+		if found {
+			newEntries[i].AccessTime = old.AccessTime
+			newEntries[i].LaunchCount = old.LaunchCount
+			newEntries[i].Frecency = old.Frecency
+		} else {
+			log.Info("New:", newEntries[i].Id)
 			added++
 		}
+		if err := tx.Save(newEntries[i]); err != nil {
+			log.Error("Cannot save entry, aborting: ", err)
+			tx.Rollback()
+			return err
+		}
 	}
 	log.Info("Refresh complete, added apps: ", added)
 	if err := tx.Commit(); err != nil {
@@ -266,16 +514,101 @@ func (s *GoclipDBStorm) AddShellEntries(entries []*db.ShellEntry) error {
 	return nil
 }
 
+const maxCommandRecords = 500
+
+func (s *GoclipDBStorm) SaveCommandRecord(record *db.CommandRecord) error {
+	isNew := record.Id == 0
+	if err := s.shellDb.Save(record); err != nil {
+		log.Error("Error saving command record: ", err)
+		return err
+	}
+	if !isNew {
+		return nil
+	}
+	var old []*db.CommandRecord
+	if err := s.shellDb.AllByIndex("Start", &old, storm.Reverse(), storm.Skip(maxCommandRecords)); err != nil {
+		log.Warning("Error getting old command records: ", err)
+		return nil
+	}
+	for _, r := range old {
+		if err := s.shellDb.DeleteStruct(r); err != nil {
+			log.Warning("Error deleting old command record: ", err)
+		}
+	}
+	return nil
+}
+
+// finishStaleRecords marks the commands still running when Goclip last exited as finished,
+// with an unknown exit status
+func (s *GoclipDBStorm) finishStaleRecords() {
+	var stale []*db.CommandRecord
+	if err := s.shellDb.Find("Running", true, &stale); err != nil {
+		if err != storm.ErrNotFound {
+			log.Error("Error getting running command records: ", err)
+		}
+		return
+	}
+	for _, record := range stale {
+		record.Running = false
+		record.ExitCode = -1
+		record.Error = "Goclip exited while the command was running"
+		if err := s.shellDb.Save(record); err != nil {
+			log.Warning("Error saving command record: ", err)
+		}
+	}
+}
+
+func (s *GoclipDBStorm) GetCommandRecords(limit int) []*db.CommandRecord {
+	var records []*db.CommandRecord
+	if err := s.shellDb.AllByIndex("Start", &records, storm.Reverse(), storm.Limit(limit)); err != nil && err != storm.ErrNotFound {
+		log.Error("Error getting command records: ", err)
+	}
+	return records
+}
+
+type shellMatcher struct {
+	pattern string
+	ranks   map[string]int
+}
+
+// Match is given the entry by value by storm's Select
+func (s *shellMatcher) Match(i interface{}) (bool, error) {
+	var entry *db.ShellEntry
+	switch e := i.(type) {
+	case db.ShellEntry:
+		entry = &e
+	case *db.ShellEntry:
+		entry = e
+	default:
+		return false, nil
+	}
+	score, _, ok := utils.FuzzyMatch(s.pattern, entry.Cmd)
+	if ok {
+		s.ranks[entry.Cmd] = score + utils.Frecency(entry.Count, entry.LastUsed)
+	}
+	return ok, nil
+}
+
 func (s *GoclipDBStorm) GetShellEntries(cmd string, limit int) ([]*db.ShellEntry, error) {
-	query := s.shellDb.Select(q.Re("Cmd", "(?i).*"+cmd+".*")).Limit(limit)
+	matcher := &shellMatcher{pattern: cmd, ranks: map[string]int{}}
 	var results []*db.ShellEntry
-	if err := query.Find(&results); err != nil {
-		if strings.Contains(err.Error(), "not found") {
+	if err := s.shellDb.Select(matcher).Find(&results); err != nil {
+		if err == storm.ErrNotFound {
 			return nil, nil
 		}
 		log.Error("Error finding completions: ", err)
 		return nil, err
 	}
+	sort.SliceStable(results, func(i, j int) bool {
+		ri, rj := matcher.ranks[results[i].Cmd], matcher.ranks[results[j].Cmd]
+		if ri != rj {
+			return ri > rj
+		}
+		return results[i].Index < results[j].Index
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
 	return results, nil
 }
 
@@ -289,18 +622,17 @@ func (s *GoclipDBStorm) GetAppEntries() []*db.AppEntry {
 	return entries
 }
 
-func (s *GoclipDBStorm) GetAppEntry(cmd string) (*db.AppEntry, error) {
+func (s *GoclipDBStorm) GetAppEntry(id string) (*db.AppEntry, error) {
 	entry := db.AppEntry{}
-	if err := s.appDb.One("Exec", cmd, &entry); err != nil {
+	if err := s.appDb.One("Id", id, &entry); err != nil {
 		log.Error("Error getting db entry:", err)
 		return nil, err
 	}
 	return &entry, nil
 }
 
-func (s *GoclipDBStorm) UpdateAppEntry(entry *db.AppEntry) {
-	entry.AccessTime = time.Now()
-	if err := s.appDb.Update(entry); err != nil {
+func (s *GoclipDBStorm) SaveAppEntry(entry *db.AppEntry) {
+	if err := s.appDb.Save(entry); err != nil {
 		log.Warning("Error updating entry: ", err)
 	}
 }
@@ -0,0 +1,149 @@
+package storm
+
+import (
+	"Goclip/db"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func newTestDb(t *testing.T) db.GoclipDB {
+	t.Helper()
+	gdb, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gdb
+}
+
+func addEntry(t *testing.T, gdb db.GoclipDB, data string, starred bool, at time.Time) {
+	t.Helper()
+	entry := &db.ClipboardEntry{
+		Md5:       data,
+		Timestamp: at,
+		Mime:      "text/plain",
+		Data:      []byte(data),
+		Starred:   starred,
+	}
+	if err := gdb.AddClipboardEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCleanupIgnoresKeptEntries(t *testing.T) {
+	gdb := newTestDb(t)
+	settings := db.DefaultSettings()
+	settings.MaxEntries = 2
+	if err := gdb.SaveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 3; i++ {
+		addEntry(t, gdb, fmt.Sprint("kept", i), true, start.Add(time.Duration(i)*time.Second))
+	}
+	for i := 0; i < 3; i++ {
+		addEntry(t, gdb, fmt.Sprint("new", i), false, start.Add(time.Duration(10+i)*time.Second))
+	}
+
+	found := map[string]bool{}
+	for _, entry := range gdb.GetClipboardEntries() {
+		found[entry.Md5] = true
+	}
+	for _, md5 := range []string{"kept0", "kept1", "kept2", "new1", "new2"} {
+		if !found[md5] {
+			t.Errorf("entry %s was deleted", md5)
+		}
+	}
+	if found["new0"] {
+		t.Error("oldest unkept entry was not deleted")
+	}
+	if len(found) != 5 {
+		t.Errorf("got %d entries, want 5", len(found))
+	}
+}
+
+func TestFindClipboardEntries(t *testing.T) {
+	gdb := newTestDb(t)
+	now := time.Now()
+	entries := []*db.ClipboardEntry{
+		{Md5: "hello", Timestamp: now, Mime: "text/plain", Data: []byte("Hello world"), Starred: true},
+		{Md5: "list", Timestamp: now, Mime: "text/plain", Data: []byte("grocery list"), Tags: []string{"work"}},
+		{Md5: "image", Timestamp: now, Mime: "image/png", Data: make([]byte, 2048)},
+	}
+	for _, entry := range entries {
+		if err := gdb.AddClipboardEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"hello", "image", "list"}},
+		{"hello", []string{"hello"}},
+		{"wrld", []string{"hello"}},
+		{"is:starred", []string{"hello"}},
+		{"tag:work", []string{"list"}},
+		{"type:image size:>1k", []string{"image"}},
+		{"type:text -hello", []string{"list"}},
+		{"missing", nil},
+	}
+	for _, test := range tests {
+		query, err := db.ParseClipboardQuery(test.query)
+		if err != nil {
+			t.Fatalf("%q: %v", test.query, err)
+		}
+		found, err := gdb.FindClipboardEntries(query)
+		if err != nil {
+			t.Fatalf("%q: %v", test.query, err)
+		}
+		var got []string
+		for _, entry := range found {
+			got = append(got, entry.Md5)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestGetShellEntries(t *testing.T) {
+	gdb := newTestDb(t)
+	history := []*db.ShellEntry{
+		{Cmd: "git status", IsHistory: true, Index: 0},
+		{Cmd: "ls -la", IsHistory: true, Index: 1},
+		{Cmd: "echo (test)", IsHistory: true, Index: 2},
+	}
+	if err := gdb.AddShellEntries(history); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cmd  string
+		want []string
+	}{
+		{"", []string{"git status", "ls -la", "echo (test)"}},
+		{"git", []string{"git status"}},
+		{"gst", []string{"git status"}},
+		{"(", []string{"echo (test)"}},
+		{"missing", nil},
+	}
+	for _, test := range tests {
+		entries, err := gdb.GetShellEntries(test.cmd, 10)
+		if err != nil {
+			t.Fatalf("%q: %v", test.cmd, err)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.Cmd)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.cmd, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package imgutils
+
+import (
+	"Goclip/log"
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	MimePng  = "image/png"
+	MimeJpeg = "image/jpeg"
+	MimeWebp = "image/webp"
+)
+
+const jpegQuality = 90
+
+// maxImageSize is the largest width or height of a resized image
+const maxImageSize = 16384
+
+var ErrInvalidGeometry = errors.New("invalid geometry")
+
+func Decode(data []byte) (image.Image, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Error("Error decoding image: ", err)
+		return nil, "", err
+	}
+	return img, "image/" + format, nil
+}
+
+// WebP encoding relies on the external cwebp tool, since there is no pure Go encoder.
+func Encode(img image.Image, mime string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch mime {
+	case MimePng:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+	case MimeJpeg:
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+	case MimeWebp:
+		return encodeWebp(img)
+	default:
+		return nil, fmt.Errorf("unsupported image format: %s", mime)
+	}
+	return buf.Bytes(), nil
+}
+
+// CanEncode tells whether images can be converted to mime, WebP needs cwebp to be installed
+func CanEncode(mime string) bool {
+	switch mime {
+	case MimePng, MimeJpeg:
+		return true
+	case MimeWebp:
+		_, err := exec.LookPath("cwebp")
+		return err == nil
+	}
+	return false
+}
+
+func encodeWebp(img image.Image) ([]byte, error) {
+	cwebp, err := exec.LookPath("cwebp")
+	if err != nil {
+		log.Error("WebP encoding requires cwebp: ", err)
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile("", "gocliptmp*.png")
+	if err != nil {
+		log.Error("Error creating temp file: ", err)
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := png.Encode(tmp, img); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	tmp.Close()
+	out, err := exec.Command(cwebp, "-quiet", tmp.Name(), "-o", "-").Output()
+	if err != nil {
+		log.Error("Error running cwebp: ", err)
+		return nil, err
+	}
+	return out, nil
+}
+
+func transform(data []byte, f func(image.Image) (image.Image, error)) ([]byte, string, error) {
+	img, mime, err := Decode(data)
+	if err != nil {
+		return nil, "", err
+	}
+	if img, err = f(img); err != nil {
+		return nil, "", err
+	}
+	out, err := Encode(img, mime)
+	if err != nil {
+		// Formats we can decode but not encode (e.g. gif) fall back to png
+		out, err = Encode(img, MimePng)
+		mime = MimePng
+	}
+	return out, mime, err
+}
+
+func scale(img image.Image, width, height int) image.Image {
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Over, nil)
+	return dst
+}
+
+func ResizePercent(data []byte, percent int) ([]byte, string, error) {
+	if percent <= 0 {
+		return nil, "", ErrInvalidGeometry
+	}
+	return transform(data, func(img image.Image) (image.Image, error) {
+		b := img.Bounds()
+		width, height := b.Dx()*percent/100, b.Dy()*percent/100
+		// The aspect ratio is kept when clamping
+		if width > maxImageSize || height > maxImageSize {
+			if width >= height {
+				width, height = maxImageSize, maxImageSize*b.Dy()/b.Dx()
+			} else {
+				width, height = maxImageSize*b.Dx()/b.Dy(), maxImageSize
+			}
+		}
+		return scale(img, width, height), nil
+	})
+}
+
+func ResizeMax(data []byte, maxSize int) ([]byte, string, error) {
+	if maxSize <= 0 {
+		return nil, "", ErrInvalidGeometry
+	}
+	return transform(data, func(img image.Image) (image.Image, error) {
+		b := img.Bounds()
+		if b.Dx() <= maxSize && b.Dy() <= maxSize {
+			return img, nil
+		}
+		if b.Dx() >= b.Dy() {
+			return scale(img, maxSize, maxSize*b.Dy()/b.Dx()), nil
+		}
+		return scale(img, maxSize*b.Dx()/b.Dy(), maxSize), nil
+	})
+}
+
+// Resize accepts either a percentage ("50%") or a maximum dimension ("800").
+func Resize(data []byte, spec string) ([]byte, string, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasSuffix(spec, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(spec, "%"))
+		if err != nil {
+			return nil, "", ErrInvalidGeometry
+		}
+		return ResizePercent(data, percent)
+	}
+	maxSize, err := strconv.Atoi(spec)
+	if err != nil {
+		return nil, "", ErrInvalidGeometry
+	}
+	return ResizeMax(data, maxSize)
+}
+
+// ParseGeometry parses an X11-style geometry string: WxH+X+Y.
+func ParseGeometry(geometry string) (image.Rectangle, error) {
+	var w, h, x, y int
+	geometry = strings.TrimSpace(geometry)
+	if _, err := fmt.Sscanf(geometry, "%dx%d+%d+%d", &w, &h, &x, &y); err != nil {
+		if _, err := fmt.Sscanf(geometry, "%dx%d", &w, &h); err != nil {
+			return image.Rectangle{}, ErrInvalidGeometry
+		}
+	}
+	if w <= 0 || h <= 0 || x < 0 || y < 0 {
+		return image.Rectangle{}, ErrInvalidGeometry
+	}
+	return image.Rect(x, y, x+w, y+h), nil
+}
+
+func Crop(data []byte, geometry string) ([]byte, string, error) {
+	rect, err := ParseGeometry(geometry)
+	if err != nil {
+		return nil, "", err
+	}
+	return transform(data, func(img image.Image) (image.Image, error) {
+		b := img.Bounds()
+		rect = rect.Add(b.Min).Intersect(b)
+		if rect.Empty() {
+			return nil, ErrInvalidGeometry
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+		draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+		return dst, nil
+	})
+}
+
+func Rotate(data []byte, degrees int) ([]byte, string, error) {
+	degrees = ((degrees % 360) + 360) % 360
+	if degrees%90 != 0 {
+		return nil, "", fmt.Errorf("unsupported rotation: %d", degrees)
+	}
+	return transform(data, func(img image.Image) (image.Image, error) {
+		b := img.Bounds()
+		w, h := b.Dx(), b.Dy()
+		var dst *image.RGBA
+		if degrees == 90 || degrees == 270 {
+			dst = image.NewRGBA(image.Rect(0, 0, h, w))
+		} else {
+			dst = image.NewRGBA(image.Rect(0, 0, w, h))
+		}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				c := img.At(b.Min.X+x, b.Min.Y+y)
+				switch degrees {
+				case 0:
+					dst.Set(x, y, c)
+				case 90:
+					dst.Set(h-1-y, x, c)
+				case 180:
+					dst.Set(w-1-x, h-1-y, c)
+				case 270:
+					dst.Set(y, w-1-x, c)
+				}
+			}
+		}
+		return dst, nil
+	})
+}
+
+func Convert(data []byte, mime string) ([]byte, string, error) {
+	img, _, err := Decode(data)
+	if err != nil {
+		return nil, "", err
+	}
+	out, err := Encode(img, mime)
+	if err != nil {
+		log.Error("Error converting image: ", err)
+		return nil, "", err
+	}
+	return out, mime, nil
+}
@@ -6,7 +6,9 @@ import (
 	"Goclip/db"
 	"Goclip/db/storm"
 	"Goclip/log"
+	"Goclip/scriptutils"
 	"Goclip/shellutils"
+	"Goclip/snippetutils"
 	"Goclip/ui"
 	"Goclip/ui/gtk/launcher"
 	"Goclip/ui/gtk/settings"
@@ -18,19 +20,24 @@ import (
 
 var dbDir = "~/goclip"
 
+// Ctrl, meta and alt, both left and right
+const modifierMask = 0xee
+
 type GoclipListener struct {
 	db           db.GoclipDB
 	clipLauncher ui.GoclipLauncher
 	appLauncher  ui.GoclipLauncher
 	cmdLauncher  ui.GoclipLauncher
+	expander     *snippetutils.Expander
 }
 
-func HotkeyListener(goclipDB db.GoclipDB, clipLauncher ui.GoclipLauncher, appLauncher ui.GoclipLauncher, cmdLauncher ui.GoclipLauncher) *GoclipListener {
+func HotkeyListener(goclipDB db.GoclipDB, clipLauncher ui.GoclipLauncher, appLauncher ui.GoclipLauncher, cmdLauncher ui.GoclipLauncher, expander *snippetutils.Expander) *GoclipListener {
 	return &GoclipListener{
 		db:           goclipDB,
 		clipLauncher: clipLauncher,
 		appLauncher:  appLauncher,
 		cmdLauncher:  cmdLauncher,
+		expander:     expander,
 	}
 }
 
@@ -53,6 +60,16 @@ func (s *GoclipListener) startHotkeyListener() {
 	hook.Register(hook.KeyDown, strings.Split(sets.ShellShortcut, "+"), func(event hook.Event) {
 		s.cmdLauncher.ShowEntries()
 	})
+	hook.Register(hook.KeyDown, []string{}, func(event hook.Event) {
+		if event.Mask&modifierMask != 0 {
+			s.expander.Reset()
+		} else {
+			s.expander.HandleChar(event.Keychar)
+		}
+	})
+	hook.Register(hook.MouseDown, []string{}, func(event hook.Event) {
+		s.expander.Reset()
+	})
 	start := hook.Start()
 	<-hook.Process(start)
 }
@@ -67,21 +84,33 @@ func main() {
 	if err != nil {
 		return
 	}
+	shellutils.SetEnvOverrides(goclipDb.GetEnvOverrides)
+	shellutils.SetSettings(goclipDb.GetSettings)
+	shellutils.SetCommandRecorder(goclipDb.SaveCommandRecord)
+	scriptManager := scriptutils.NewScriptManager(filepath.Join(dbDir, "scripts"))
 	clipManager := cliputils.NewClipboardManager(goclipDb)
+	scriptManager.SetClipboard(clipManager)
+	scriptManager.LoadScripts()
+	clipManager.SetScriptManager(scriptManager)
 	clipManager.StartListener()
 	appManager := apputils.NewAppManager(goclipDb)
+	clipManager.SetAppManager(appManager)
 	shellManager := shellutils.NewShellManager(goclipDb)
 	go shellManager.LoadHistory()
 
-	clipLauncher := launcher.NewClipboardLauncher(clipManager)
+	snippetManager := snippetutils.NewSnippetManager(goclipDb)
+
+	clipLauncher := launcher.NewClipboardLauncher(clipManager, snippetManager)
 	appLauncher := launcher.NewAppsLauncher(appManager)
-	cmdLauncher := launcher.NewShellLauncher(shellManager)
+	go appManager.StartWatcher()
+	cmdLauncher := launcher.NewShellLauncher(shellManager, scriptManager, clipManager)
 
 	settingsApp := settings.New(goclipDb, clipLauncher, appLauncher, cmdLauncher)
 	settingsApp.SetReloadAppsCallback(appLauncher.RedrawApps)
 
 	log.Info("Starting listener")
-	hotkeyListener := HotkeyListener(goclipDb, clipLauncher, appLauncher, cmdLauncher)
+	expander := snippetutils.NewExpander(goclipDb, snippetManager, clipManager)
+	hotkeyListener := HotkeyListener(goclipDb, clipLauncher, appLauncher, cmdLauncher, expander)
 	hotkeyListener.Start()
 
 	settingsApp.Run()
@@ -0,0 +1,343 @@
+package scriptutils
+
+import (
+	"Goclip/db"
+	"Goclip/log"
+	"Goclip/shellutils"
+	"Goclip/utils"
+	"fmt"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const scriptExt = ".star"
+const maxExecutionSteps = 10000000
+
+// providerTimeout is the time a provider has to answer a query typed in the launcher
+const providerTimeout = 300 * time.Millisecond
+
+type Clipboard interface {
+	WriteText(text string)
+	WriteImage(data []byte)
+}
+
+type Transform struct {
+	Name   string
+	Script string
+	fn     starlark.Callable
+}
+
+type Provider struct {
+	Name   string
+	Script string
+	fn     starlark.Callable
+}
+
+type Result struct {
+	Label    string
+	Cmd      string
+	Text     string
+	Terminal bool
+}
+
+// registry collects what the scripts register while they are loaded
+type registry struct {
+	transforms []*Transform
+	hooks      []starlark.Callable
+	providers  []*Provider
+}
+
+type ScriptManager struct {
+	dir        string
+	clipboard  Clipboard
+	mu         sync.Mutex
+	transforms []*Transform
+	hooks      []starlark.Callable
+	providers  []*Provider
+}
+
+func NewScriptManager(dir string) *ScriptManager {
+	return &ScriptManager{dir: dir}
+}
+
+func (s *ScriptManager) SetClipboard(clipboard Clipboard) {
+	s.clipboard = clipboard
+}
+
+func (s *ScriptManager) newThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(thread *starlark.Thread, msg string) {
+			log.Info("[", thread.Name, "] ", msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(maxExecutionSteps)
+	return thread
+}
+
+func (s *ScriptManager) LoadScripts() {
+	reg := &registry{}
+	defer func() {
+		sort.Slice(reg.transforms, func(i, j int) bool {
+			return reg.transforms[i].Name < reg.transforms[j].Name
+		})
+		s.mu.Lock()
+		s.transforms = reg.transforms
+		s.hooks = reg.hooks
+		s.providers = reg.providers
+		s.mu.Unlock()
+	}()
+
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		log.Error("Error opening scripts directory: ", err)
+		return
+	}
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		log.Error("Cannot read scripts directory: ", err)
+		return
+	}
+	for _, finfo := range files {
+		if finfo.IsDir() || !strings.HasSuffix(finfo.Name(), scriptExt) {
+			continue
+		}
+		fn := filepath.Join(s.dir, finfo.Name())
+		thread := s.newThread(finfo.Name())
+		if _, err := starlark.ExecFile(thread, fn, nil, s.predeclared(reg, finfo.Name())); err != nil {
+			log.Error("Error loading script ", fn, ": ", err)
+			continue
+		}
+		log.Info("Loaded script: ", fn)
+	}
+}
+
+func (s *ScriptManager) predeclared(reg *registry, script string) starlark.StringDict {
+	module := &starlarkstruct.Module{
+		Name: "goclip",
+		Members: starlark.StringDict{
+			"register_transform": starlark.NewBuiltin("register_transform", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var name string
+				var fn starlark.Callable
+				if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "fn", &fn); err != nil {
+					return nil, err
+				}
+				s.mu.Lock()
+				reg.transforms = append(reg.transforms, &Transform{Name: name, Script: script, fn: fn})
+				s.mu.Unlock()
+				return starlark.None, nil
+			}),
+			"register_provider": starlark.NewBuiltin("register_provider", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var name string
+				var fn starlark.Callable
+				if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "fn", &fn); err != nil {
+					return nil, err
+				}
+				s.mu.Lock()
+				reg.providers = append(reg.providers, &Provider{Name: name, Script: script, fn: fn})
+				s.mu.Unlock()
+				return starlark.None, nil
+			}),
+			"on_copy": starlark.NewBuiltin("on_copy", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var fn starlark.Callable
+				if err := starlark.UnpackArgs(b.Name(), args, kwargs, "fn", &fn); err != nil {
+					return nil, err
+				}
+				s.mu.Lock()
+				reg.hooks = append(reg.hooks, fn)
+				s.mu.Unlock()
+				return starlark.None, nil
+			}),
+			"write_text": starlark.NewBuiltin("write_text", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var text string
+				if err := starlark.UnpackArgs(b.Name(), args, kwargs, "text", &text); err != nil {
+					return nil, err
+				}
+				if s.clipboard != nil {
+					s.clipboard.WriteText(text)
+				}
+				return starlark.None, nil
+			}),
+			"write_image": starlark.NewBuiltin("write_image", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var data starlark.Bytes
+				if err := starlark.UnpackArgs(b.Name(), args, kwargs, "data", &data); err != nil {
+					return nil, err
+				}
+				if s.clipboard != nil {
+					s.clipboard.WriteImage([]byte(data))
+				}
+				return starlark.None, nil
+			}),
+			"exec": starlark.NewBuiltin("exec", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var cmd string
+				terminal := false
+				if err := starlark.UnpackArgs(b.Name(), args, kwargs, "cmd", &cmd, "terminal?", &terminal); err != nil {
+					return nil, err
+				}
+				shellutils.Exec(cmd, terminal)
+				return starlark.None, nil
+			}),
+		},
+	}
+	return starlark.StringDict{"goclip": module}
+}
+
+func entryToDict(entry *db.ClipboardEntry) *starlark.Dict {
+	dict := starlark.NewDict(9)
+	dict.SetKey(starlark.String("mime"), starlark.String(entry.Mime))
+	dict.SetKey(starlark.String("class"), starlark.String(entry.Class))
+	dict.SetKey(starlark.String("starred"), starlark.Bool(entry.Starred))
+	dict.SetKey(starlark.String("source_class"), starlark.String(entry.SourceClass))
+	dict.SetKey(starlark.String("source_title"), starlark.String(entry.SourceTitle))
+	dict.SetKey(starlark.String("use_count"), starlark.MakeInt(entry.UseCount))
+	if entry.IsText() {
+		dict.SetKey(starlark.String("data"), starlark.String(entry.Data))
+	} else {
+		dict.SetKey(starlark.String("data"), starlark.Bytes(entry.Data))
+	}
+	var tags []starlark.Value
+	for _, tag := range entry.Tags {
+		tags = append(tags, starlark.String(tag))
+	}
+	dict.SetKey(starlark.String("tags"), starlark.NewList(tags))
+	return dict
+}
+
+func dictToEntry(dict *starlark.Dict, entry *db.ClipboardEntry) error {
+	if value, found, _ := dict.Get(starlark.String("data")); found {
+		switch data := value.(type) {
+		case starlark.String:
+			entry.Data = []byte(data)
+		case starlark.Bytes:
+			entry.Data = []byte(data)
+		default:
+			return fmt.Errorf("invalid data type: %s", value.Type())
+		}
+		entry.Md5 = utils.Md5Digest(entry.Data)
+	}
+	if value, found, _ := dict.Get(starlark.String("starred")); found {
+		entry.Starred = bool(value.Truth())
+	}
+	if value, found, _ := dict.Get(starlark.String("tags")); found {
+		if list, ok := value.(*starlark.List); ok {
+			entry.Tags = nil
+			for i := 0; i < list.Len(); i++ {
+				if tag, ok := starlark.AsString(list.Index(i)); ok {
+					entry.Tags = append(entry.Tags, tag)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// OnCopy runs the registered on_copy hooks. It returns nil when a hook drops the entry.
+func (s *ScriptManager) OnCopy(entry *db.ClipboardEntry) *db.ClipboardEntry {
+	s.mu.Lock()
+	hooks := s.hooks
+	s.mu.Unlock()
+	for _, hook := range hooks {
+		value, err := starlark.Call(s.newThread("on_copy"), hook, starlark.Tuple{entryToDict(entry)}, nil)
+		if err != nil {
+			log.Error("Error running on_copy hook: ", err)
+			continue
+		}
+		if value == starlark.None {
+			log.Info("Entry dropped by script")
+			return nil
+		}
+		dict, ok := value.(*starlark.Dict)
+		if !ok {
+			log.Error("Invalid on_copy result: ", value.Type())
+			continue
+		}
+		if err := dictToEntry(dict, entry); err != nil {
+			log.Error("Invalid on_copy result: ", err)
+		}
+	}
+	return entry
+}
+
+func (s *ScriptManager) GetTransforms() []*Transform {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transforms
+}
+
+func (s *ScriptManager) RunTransform(transform *Transform, text string) (string, error) {
+	value, err := starlark.Call(s.newThread(transform.Script), transform.fn, starlark.Tuple{starlark.String(text)}, nil)
+	if err != nil {
+		log.Error("Error running transform ", transform.Name, ": ", err)
+		return "", err
+	}
+	result, ok := starlark.AsString(value)
+	if !ok {
+		return "", fmt.Errorf("transform %s returned %s instead of a string", transform.Name, value.Type())
+	}
+	return result, nil
+}
+
+func (s *ScriptManager) Query(text string) []*Result {
+	s.mu.Lock()
+	providers := s.providers
+	s.mu.Unlock()
+	var results []*Result
+	for _, provider := range providers {
+		thread := s.newThread(provider.Script)
+		timer := time.AfterFunc(providerTimeout, func() {
+			thread.Cancel("timeout")
+		})
+		value, err := starlark.Call(thread, provider.fn, starlark.Tuple{starlark.String(text)}, nil)
+		timer.Stop()
+		if err != nil {
+			log.Error("Error running provider ", provider.Name, ": ", err)
+			continue
+		}
+		iterable, ok := value.(starlark.Iterable)
+		if !ok {
+			log.Error("Provider ", provider.Name, " returned ", value.Type(), " instead of a list")
+			continue
+		}
+		iter := iterable.Iterate()
+		var item starlark.Value
+		for iter.Next(&item) {
+			dict, ok := item.(*starlark.Dict)
+			if !ok {
+				continue
+			}
+			result := &Result{}
+			if value, found, _ := dict.Get(starlark.String("label")); found {
+				result.Label, _ = starlark.AsString(value)
+			}
+			if value, found, _ := dict.Get(starlark.String("cmd")); found {
+				result.Cmd, _ = starlark.AsString(value)
+			}
+			if value, found, _ := dict.Get(starlark.String("text")); found {
+				result.Text, _ = starlark.AsString(value)
+			}
+			if value, found, _ := dict.Get(starlark.String("terminal")); found {
+				result.Terminal = bool(value.Truth())
+			}
+			if result.Label == "" {
+				result.Label = result.Cmd + result.Text
+			}
+			results = append(results, result)
+		}
+		iter.Done()
+	}
+	return results
+}
+
+func (s *ScriptManager) RunResult(result *Result) {
+	if result.Cmd != "" {
+		shellutils.Exec(result.Cmd, result.Terminal)
+	} else if result.Text != "" && s.clipboard != nil {
+		s.clipboard.WriteText(result.Text)
+	}
+}
@@ -0,0 +1,110 @@
+package shellutils
+
+import (
+	"Goclip/db"
+	"Goclip/log"
+	"Goclip/utils"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// maxCaptureOutput is the size of the captured output, the rest is dropped
+const maxCaptureOutput = 1 << 20
+
+// ErrTimeout is returned by Capture when the command does not finish in time
+var ErrTimeout = errors.New("command timed out")
+
+// limitedBuffer keeps the first max bytes written to it and discards the others
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (s *limitedBuffer) Write(p []byte) (int, error) {
+	if room := s.max - s.buf.Len(); len(p) > room {
+		s.buf.Write(p[:room])
+		s.truncated = true
+		return len(p), nil
+	}
+	return s.buf.Write(p)
+}
+
+// RunGroup runs cmd in its own process group and kills the whole group when ctx is done,
+// so that the children still holding the output pipes do not block it
+func RunGroup(ctx context.Context, cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	pid := cmd.Process.Pid
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+	return cmd.Wait()
+}
+
+// Capture runs command without a terminal and returns its stdout and stderr, and its exit code
+func Capture(command string, timeout time.Duration) ([]byte, int, error) {
+	record := &db.CommandRecord{Source: db.CommandSourceCapture, Command: command, ExitCode: -1}
+	out, err := capture(record, timeout)
+	record.Output = truncateOutput(out)
+	if err != nil {
+		record.Error = err.Error()
+	}
+	saveRecord(record)
+	return out, record.ExitCode, err
+}
+
+func capture(record *db.CommandRecord, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", record.Command)
+	cmd.Env = LaunchEnv(commandName(record.Command))
+	out := &limitedBuffer{max: maxCaptureOutput}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if wd, err := os.Getwd(); err == nil {
+		record.Dir = wd
+	}
+	log.Info("Capturing: ", record.Command)
+	record.Start = time.Now()
+	err := RunGroup(ctx, cmd)
+	record.Duration = time.Since(record.Start)
+	if out.truncated {
+		log.Warning("Command output truncated to ", maxCaptureOutput, " bytes")
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return out.buf.Bytes(), ErrTimeout
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		record.ExitCode = exitErr.ExitCode()
+		return out.buf.Bytes(), nil
+	}
+	if err != nil {
+		return out.buf.Bytes(), err
+	}
+	record.ExitCode = 0
+	return out.buf.Bytes(), nil
+}
+
+// Notify shows a desktop notification
+func Notify(summary string, body string) {
+	cmd := exec.Command("notify-send", "--app-name="+utils.AppName, summary, body)
+	cmd.Env = LaunchEnv("notify-send")
+	if err := cmd.Run(); err != nil {
+		log.Warning("Cannot show notification: ", err)
+	}
+}
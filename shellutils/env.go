@@ -0,0 +1,156 @@
+package shellutils
+
+import (
+	"Goclip/db"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// snapEnvVars are set by the snap runtime for Goclip itself and break the apps it launches
+var snapEnvVars = []string{
+	"GTK_PATH", "GTK_EXE_PREFIX", "GTK_DATA_PREFIX", "GTK_IM_MODULE_FILE", "GIO_MODULE_DIR",
+	"GDK_PIXBUF_MODULE_FILE", "GDK_PIXBUF_MODULEDIR", "GSETTINGS_SCHEMA_DIR", "LOCPATH",
+	"LIBGL_DRIVERS_PATH", "__EGL_VENDOR_LIBRARY_DIRS", "GST_PLUGIN_PATH", "GST_PLUGIN_SYSTEM_PATH",
+}
+
+// snapPathVars are lists of paths where the snap runtime adds its own directories
+var snapPathVars = []string{
+	"PATH", "LD_LIBRARY_PATH", "XDG_DATA_DIRS", "XDG_CONFIG_DIRS", "GI_TYPELIB_PATH", "PYTHONPATH", "PERL5LIB",
+}
+
+var envOverrides func() []*db.EnvOverride
+
+// SetEnvOverrides sets the source of the per-app environment overrides
+func SetEnvOverrides(f func() []*db.EnvOverride) {
+	envOverrides = f
+}
+
+// LaunchEnv returns the environment for a launched program: Goclip's environment without
+// the snap runtime variables, then the overrides matching one of apps
+func LaunchEnv(apps ...string) []string {
+	env := sanitizeEnv(os.Environ())
+	if envOverrides == nil {
+		return env
+	}
+	var overrides []*db.EnvOverride
+	for _, o := range envOverrides() {
+		if o.App == "*" || matchesApp(o.App, apps) {
+			overrides = append(overrides, o)
+		}
+	}
+	// The overrides for all apps come first, so that the specific ones win
+	sort.SliceStable(overrides, func(i, j int) bool {
+		return overrides[i].App == "*" && overrides[j].App != "*"
+	})
+	for _, o := range overrides {
+		env = setEnv(env, o.Name, o.Value)
+	}
+	return env
+}
+
+// LaunchPath returns the $PATH of the launched programs, without the snap directories
+func LaunchPath() string {
+	for _, kv := range LaunchEnv() {
+		if strings.HasPrefix(kv, "PATH=") {
+			return strings.TrimPrefix(kv, "PATH=")
+		}
+	}
+	return ""
+}
+
+func matchesApp(app string, apps []string) bool {
+	for _, a := range apps {
+		if a != "" && (a == app || strings.TrimSuffix(a, ".desktop") == app) {
+			return true
+		}
+	}
+	return false
+}
+
+func setEnv(env []string, name string, value string) []string {
+	var result []string
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, name+"=") {
+			result = append(result, kv)
+		}
+	}
+	if value != "" {
+		result = append(result, name+"="+value)
+	}
+	return result
+}
+
+// sanitizeEnv strips the variables set by the snap runtime when running from the snap, and the
+// paths under the snap directories. The stripped values are not restored to what they were before
+// the snap started, except XDG_RUNTIME_DIR and HOME which can be derived from the snap variables.
+func sanitizeEnv(env []string) []string {
+	snap := os.Getenv("SNAP")
+	if snap == "" {
+		return env
+	}
+	var roots []string
+	for _, name := range []string{"SNAP", "SNAP_DATA", "SNAP_COMMON", "SNAP_USER_DATA", "SNAP_USER_COMMON"} {
+		if dir := os.Getenv(name); dir != "" {
+			roots = append(roots, filepath.Clean(dir))
+		}
+	}
+	inSnap := func(path string) bool {
+		for _, root := range roots {
+			if path == root || strings.HasPrefix(path, root+"/") {
+				return true
+			}
+		}
+		return false
+	}
+	var result []string
+	for _, kv := range env {
+		name, value := kv, ""
+		if idx := strings.Index(kv, "="); idx >= 0 {
+			name, value = kv[:idx], kv[idx+1:]
+		}
+		if name == "SNAP" || strings.HasPrefix(name, "SNAP_") || contains(snapEnvVars, name) {
+			continue
+		}
+		if contains(snapPathVars, name) {
+			var paths []string
+			for _, path := range strings.Split(value, ":") {
+				if path != "" && !inSnap(filepath.Clean(path)) {
+					paths = append(paths, path)
+				}
+			}
+			if len(paths) > 0 {
+				result = append(result, name+"="+strings.Join(paths, ":"))
+			}
+			continue
+		}
+		switch name {
+		case "XDG_RUNTIME_DIR":
+			// The snap runtime dir is a subdirectory of the user's one
+			if snapName := os.Getenv("SNAP_NAME"); snapName != "" && filepath.Base(value) == "snap."+snapName {
+				result = append(result, name+"="+filepath.Dir(value))
+				continue
+			}
+		case "HOME":
+			if home := os.Getenv("SNAP_REAL_HOME"); home != "" {
+				result = append(result, name+"="+home)
+				continue
+			}
+		}
+		if inSnap(filepath.Clean(value)) {
+			continue
+		}
+		result = append(result, kv)
+	}
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package shellutils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type historyItem struct {
+	cmd  string
+	when time.Time
+}
+
+// fishHistoryFile returns the history file of the fish session named by $fish_history
+func fishHistoryFile() string {
+	session := os.Getenv("fish_history")
+	if session == "" {
+		session = "fish"
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = "~/.local/share"
+	}
+	return filepath.Join(dataHome, "fish", session+"_history")
+}
+
+// parseFishHistory parses the fish history format, where each entry is a "- cmd: ..." line
+// followed by indented "when:" and "paths:" keys
+func parseFishHistory(data []byte) []*historyItem {
+	var items []*historyItem
+	var item *historyItem
+	for _, line := range strings.Split(string(data), "\n") {
+		switch {
+		case strings.HasPrefix(line, "- cmd: "):
+			item = &historyItem{cmd: unescapeFish(strings.TrimPrefix(line, "- cmd: "))}
+			if item.cmd != "" {
+				items = append(items, item)
+			}
+		case item != nil && strings.HasPrefix(line, "  when: "):
+			item.when = parseEpoch(strings.TrimSpace(strings.TrimPrefix(line, "  when: ")))
+		}
+	}
+	return items
+}
+
+// unescapeFish decodes the \n and \\ escapes of a fish history command
+func unescapeFish(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			switch value[i+1] {
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			case '\\':
+				b.WriteByte('\\')
+				i++
+				continue
+			}
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
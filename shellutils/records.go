@@ -0,0 +1,37 @@
+package shellutils
+
+import (
+	"Goclip/db"
+	"Goclip/log"
+	"strings"
+)
+
+const maxRecordOutput = 4096
+
+var recorder func(record *db.CommandRecord) error
+
+// SetCommandRecorder sets where the launched commands are recorded
+func SetCommandRecorder(f func(record *db.CommandRecord) error) {
+	recorder = f
+}
+
+func saveRecord(record *db.CommandRecord) {
+	if recorder == nil {
+		return
+	}
+	if err := recorder(record); err != nil {
+		log.Warning("Cannot record command: ", err)
+	}
+}
+
+// truncateOutput keeps the beginning of a command output for its record
+func truncateOutput(out []byte) string {
+	if len(out) <= maxRecordOutput {
+		return strings.ToValidUTF8(string(out), "")
+	}
+	return strings.ToValidUTF8(string(out[:maxRecordOutput]), "") + "\n..."
+}
+
+func (s *ShellManager) GetRecords(limit int) []*db.CommandRecord {
+	return s.db.GetCommandRecords(limit)
+}
@@ -12,11 +12,14 @@ import (
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const maxCompletions = 500
 const maxHistory = 1000
+const completeEnvVar = "GOCLIP_COMPLETE"
 
 //go:embed bash_completions.sh
 var bashCompletions string
@@ -48,30 +51,39 @@ func (s *ShellManager) LoadHistory() {
 	var results []*db.ShellEntry
 	var err error
 	var data []byte
-	r := regexp.MustCompile(`^: \d+:\d+;(.+)$`)
+	r := regexp.MustCompile(`^: (\d+):\d+;(.+)$`)
+	bashTs := regexp.MustCompile(`^#(\d{9,})$`)
 
 	log.Info("Loading shell history...")
 
 	isZsh := false
 	isZshExt := false
+	isFish := false
 	histFile := ""
-	shell := os.Getenv("SHELL")
-	if strings.Contains(shell, "zsh") {
+	switch shellName() {
+	case "zsh":
 		histFile = "~/.zsh_history"
 		isZsh = true
-	} else if strings.Contains(shell, "bash") {
+	case "bash":
 		histFile = "~/.bash_history"
-	} else {
-		log.Error("Shell not supported: ", shell)
+	case "fish":
+		histFile = fishHistoryFile()
+		isFish = true
+	default:
+		log.Error("Shell not supported: ", os.Getenv("SHELL"))
 		return
 	}
-	if histFile, err = ExpandUserDir(histFile); err != nil {
-		return
+	if expanded, err := ExpandUserDir(histFile); err == nil {
+		histFile = expanded
 	}
 	if data, err = ioutil.ReadFile(histFile); err != nil {
 		log.Error("Error reading history file: ", err)
 		return
 	}
+	if isFish {
+		s.saveHistory(parseFishHistory(data))
+		return
+	}
 	if isZsh {
 		data = bytes.Replace(data, []byte("\\\n"), []byte(" "), -1)
 	}
@@ -81,17 +93,39 @@ func (s *ShellManager) LoadHistory() {
 			isZshExt = true
 		}
 	}
+	// Lines are read from the most recent, repeated commands are counted
+	seen := map[string]*db.ShellEntry{}
+	var last *db.ShellEntry
 	for i := 0; i < len(lines) && i < maxHistory; i++ {
 		line := lines[len(lines)-i-1]
+		var ts time.Time
 		if isZshExt {
 			matches := r.FindStringSubmatch(line)
-			if len(matches) == 2 {
-				line = matches[1]
+			if len(matches) == 3 {
+				ts = parseEpoch(matches[1])
+				line = matches[2]
 			} else {
 				continue
 			}
+		} else if matches := bashTs.FindStringSubmatch(line); len(matches) == 2 {
+			// HISTTIMEFORMAT timestamps precede their command
+			if last != nil && last.LastUsed.IsZero() {
+				last.LastUsed = parseEpoch(matches[1])
+			}
+			last = nil
+			continue
 		}
-		results = append(results, &db.ShellEntry{Cmd: line, IsHistory: true})
+		if line == "" {
+			continue
+		}
+		if entry, found := seen[line]; found {
+			entry.Count++
+			last = nil
+			continue
+		}
+		last = &db.ShellEntry{Cmd: line, IsHistory: true, Count: 1, LastUsed: ts, Index: len(results)}
+		seen[line] = last
+		results = append(results, last)
 	}
 	// log.Info(results)
 	if err := s.db.AddShellEntries(results); err != nil {
@@ -101,19 +135,57 @@ func (s *ShellManager) LoadHistory() {
 	return
 }
 
+// saveHistory stores history items, given from the oldest, like LoadHistory
+func (s *ShellManager) saveHistory(items []*historyItem) {
+	var results []*db.ShellEntry
+	seen := map[string]*db.ShellEntry{}
+	for i := 0; i < len(items) && len(results) < maxHistory; i++ {
+		item := items[len(items)-i-1]
+		if entry, found := seen[item.cmd]; found {
+			entry.Count++
+			continue
+		}
+		entry := &db.ShellEntry{Cmd: item.cmd, IsHistory: true, Count: 1, LastUsed: item.when, Index: len(results)}
+		seen[item.cmd] = entry
+		results = append(results, entry)
+	}
+	if err := s.db.AddShellEntries(results); err != nil {
+		log.Error("Error saving shell history: ", err)
+	}
+	log.Info("Loaded history entries: ", len(results))
+}
+
+// shellName returns the name of the user's shell, e.g. bash
+func shellName() string {
+	return filepath.Base(os.Getenv("SHELL"))
+}
+
+func parseEpoch(value string) time.Time {
+	secs, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(secs, 0)
+}
+
 func (s *ShellManager) GetShellCompletions(text string) []*db.ShellEntry {
 	var cmd *exec.Cmd
 	results, err := s.db.GetShellEntries(text, maxCompletions)
-	call := "\nget_completions '" + text + "'"
+	// The text is passed in the environment, so that it is never parsed as shell code
+	call := "\nget_completions \"$" + completeEnvVar + "\""
 	shell := os.Getenv("SHELL")
 	cmd = exec.Command(shell)
-	if strings.Contains(shell, "zsh") {
+	switch shellName() {
+	case "zsh":
 		cmd.Stdin = strings.NewReader(zshCompletions + call)
-	} else if strings.Contains(shell, "bash") {
+	case "bash":
 		cmd.Stdin = strings.NewReader(bashCompletions + call)
-	} else {
+	case "fish":
+		cmd = exec.Command(shell, "-c", "complete --do-complete=\"$"+completeEnvVar+"\"")
+	default:
 		return results
 	}
+	cmd.Env = append(os.Environ(), completeEnvVar+"="+text)
 
 	out, err := cmd.Output()
 	if err != nil {
@@ -126,6 +198,10 @@ func (s *ShellManager) GetShellCompletions(text string) []*db.ShellEntry {
 		completions = completions[:maxCompletions]
 	}
 	for _, res := range completions {
+		// Fish adds a description after a tab
+		if idx := strings.Index(res, "\t"); idx >= 0 {
+			res = res[:idx]
+		}
 		if res == "" {
 			continue
 		}
@@ -148,25 +224,117 @@ func (s *ShellManager) GetShellCompletions(text string) []*db.ShellEntry {
 }
 
 func Exec(command string, inTerminal bool) {
-	var args []string
-	if inTerminal {
-		shell := os.Getenv("SHELL")
-		if shell == "" {
-			log.Warning("Cannot find shell to run command, using /bin/sh")
-			shell = "/bin/sh"
+	run(&db.CommandRecord{Source: db.CommandSourceShell, Command: command, Terminal: inTerminal})
+}
+
+// commandName returns the name of the program run by a command line, for the environment overrides
+func commandName(command string) string {
+	fields := strings.Fields(command)
+	for _, field := range fields {
+		// Skip the variable assignments
+		if !strings.Contains(field, "=") {
+			return filepath.Base(field)
+		}
+	}
+	return ""
+}
+
+// ExecArgs runs a program with its arguments, without going through the shell unless in a terminal
+func ExecArgs(args []string, inTerminal bool) {
+	ExecApp("", args, "", inTerminal)
+}
+
+// ExecApp is ExecArgs for an app, run in dir when not empty.
+// Its desktop file ID selects the environment overrides.
+func ExecApp(id string, args []string, dir string, inTerminal bool) {
+	if len(args) == 0 {
+		return
+	}
+	run(&db.CommandRecord{
+		Source: db.CommandSourceApp, Command: QuoteArgs(args), Args: args, AppId: id, Dir: dir, Terminal: inTerminal})
+}
+
+// QuoteArgs joins args into a shell command line, quoting them when needed
+func QuoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,+@%") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
 		}
-		args = []string{"x-terminal-emulator", "-x", shell, "-i", "-c", command, ";", shell}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func Open(target string) {
+	args := []string{"xdg-open", target}
+	run(&db.CommandRecord{Source: db.CommandSourceOpen, Command: QuoteArgs(args), Args: args})
+}
+
+// Rerun launches a recorded command again, in the same directory and terminal mode
+func Rerun(record *db.CommandRecord) {
+	run(&db.CommandRecord{
+		Source:   record.Source,
+		Command:  record.Command,
+		Args:     record.Args,
+		AppId:    record.AppId,
+		Dir:      record.Dir,
+		Terminal: record.Terminal,
+	})
+}
+
+// run launches the command of record, a shell command line when it has no Args
+func run(record *db.CommandRecord) {
+	args := record.Args
+	apps := []string{record.AppId}
+	if len(args) > 0 {
+		apps = append(apps, filepath.Base(args[0]))
 	} else {
-		args = strings.Fields(command)
+		args = []string{"/bin/sh", "-c", record.Command}
+		apps = append(apps, commandName(record.Command))
+	}
+	if record.Terminal {
+		args = terminalArgs(record.Command)
 	}
+	startDetached(record, args, apps...)
+}
+
+// startDetached runs args in the launch environment of apps, then records how it exited
+func startDetached(record *db.CommandRecord, args []string, apps ...string) {
 	log.Info("Executing: ", strings.Join(args, " "))
 	cmd := exec.Command("nohup", args...)
-	// out, err := cmd.CombinedOutput()
-	err := cmd.Start()
-	if err != nil {
+	cmd.Env = LaunchEnv(apps...)
+	if record.Dir != "" {
+		dir := record.Dir
+		if expanded, err := ExpandUserDir(dir); err == nil {
+			dir = expanded
+		}
+		cmd.Dir = dir
+	} else if wd, err := os.Getwd(); err == nil {
+		record.Dir = wd
+	}
+	record.Start = time.Now()
+	record.ExitCode = -1
+	if err := cmd.Start(); err != nil {
 		log.Error("Command error: ", err)
+		record.Error = err.Error()
+		saveRecord(record)
+		return
 	}
-	// log.Info(string(out))
+	record.Running = true
+	saveRecord(record)
+	go func() {
+		err := cmd.Wait()
+		record.Running = false
+		record.Duration = time.Since(record.Start)
+		record.ExitCode = cmd.ProcessState.ExitCode()
+		if _, ok := err.(*exec.ExitError); err != nil && !ok {
+			record.Error = err.Error()
+		}
+		log.Info("Command exited with status ", record.ExitCode, ": ", record.Command)
+		saveRecord(record)
+	}()
 }
 
 func OpenEntry(entry *db.ClipboardEntry) {
@@ -174,7 +342,7 @@ func OpenEntry(entry *db.ClipboardEntry) {
 	if entry.IsText() {
 		tmpFile += ".txt"
 	} else if entry.IsImage() {
-		tmpFile += ".png"
+		tmpFile += "." + strings.TrimPrefix(entry.Mime, "image/")
 	}
 	file, err := ioutil.TempFile("/tmp", tmpFile)
 	if err != nil {
@@ -197,5 +365,5 @@ func OpenEntry(entry *db.ClipboardEntry) {
 		log.Warning("Error writing to temp file: ", err)
 		return
 	}
-	Exec("xdg-open "+filepath.Join(file.Name()), false)
+	Open(file.Name())
 }
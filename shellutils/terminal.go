@@ -0,0 +1,193 @@
+package shellutils
+
+import (
+	"Goclip/db"
+	"Goclip/log"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// TerminalCustom is the terminal setting selecting the user's own argument template
+const TerminalCustom = "custom"
+
+// commandPlaceholder is replaced in a terminal template by the program to run and its arguments
+const commandPlaceholder = "{}"
+
+// Terminal is a terminal emulator and the arguments running a program in it
+type Terminal struct {
+	Name string
+	Args []string
+}
+
+// Terminals are the supported terminals, in auto-detection order
+var Terminals = []*Terminal{
+	{Name: "x-terminal-emulator", Args: []string{"-e", commandPlaceholder}},
+	{Name: "gnome-terminal", Args: []string{"--", commandPlaceholder}},
+	{Name: "konsole", Args: []string{"-e", commandPlaceholder}},
+	{Name: "xfce4-terminal", Args: []string{"-x", commandPlaceholder}},
+	{Name: "mate-terminal", Args: []string{"-x", commandPlaceholder}},
+	{Name: "terminator", Args: []string{"-x", commandPlaceholder}},
+	{Name: "alacritty", Args: []string{"-e", commandPlaceholder}},
+	{Name: "kitty", Args: []string{commandPlaceholder}},
+	{Name: "wezterm", Args: []string{"start", "--", commandPlaceholder}},
+	{Name: "foot", Args: []string{commandPlaceholder}},
+	{Name: "ghostty", Args: []string{"-e", commandPlaceholder}},
+	{Name: "urxvt", Args: []string{"-e", commandPlaceholder}},
+	{Name: "st", Args: []string{"-e", commandPlaceholder}},
+	{Name: "xterm", Args: []string{"-e", commandPlaceholder}},
+}
+
+var getSettings func() (*db.Settings, error)
+
+// SetSettings sets the source of the settings choosing the terminal
+func SetSettings(f func() (*db.Settings, error)) {
+	getSettings = f
+}
+
+func FindTerminal(name string) *Terminal {
+	for _, t := range Terminals {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// ParseTerminal parses a custom template like "myterm --title 'My term' --exec {}", quoted like
+// in the shell. It returns nil when the template is empty or its quotes are not closed.
+func ParseTerminal(template string) *Terminal {
+	fields, err := splitArgs(template)
+	if err != nil {
+		log.Warning("Invalid terminal template: ", err)
+		return nil
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return &Terminal{Name: fields[0], Args: fields[1:]}
+}
+
+// splitArgs splits value into arguments like the shell does, without expansions
+func splitArgs(value string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote byte
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg.WriteByte(c)
+			}
+		case c == '\\' && i+1 < len(value) && (quote == 0 || strings.IndexByte("\"`$\\", value[i+1]) >= 0):
+			i++
+			arg.WriteByte(value[i])
+			inArg = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				arg.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote in: " + value)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// DetectTerminal returns the terminal named by $TERMINAL, else the first installed one
+func DetectTerminal() *Terminal {
+	if name := os.Getenv("TERMINAL"); name != "" {
+		if t := FindTerminal(filepath.Base(name)); t != nil {
+			if _, err := exec.LookPath(name); err == nil {
+				return &Terminal{Name: name, Args: t.Args}
+			}
+		}
+	}
+	for _, t := range Terminals {
+		if _, err := exec.LookPath(t.Name); err == nil {
+			return t
+		}
+	}
+	return nil
+}
+
+// CurrentTerminal returns the terminal chosen in the settings, detected when not set or not installed
+func CurrentTerminal() *Terminal {
+	settings := db.DefaultSettings()
+	if getSettings != nil {
+		if sets, err := getSettings(); err == nil {
+			settings = sets
+		}
+	}
+	var t *Terminal
+	if settings.Terminal == TerminalCustom {
+		t = ParseTerminal(settings.TerminalTemplate)
+	} else if settings.Terminal != "" {
+		t = FindTerminal(settings.Terminal)
+	}
+	if t != nil {
+		if _, err := exec.LookPath(t.Name); err == nil {
+			return t
+		}
+		log.Warning("Terminal not found: ", t.Name)
+	}
+	return DetectTerminal()
+}
+
+// Command returns the arguments running argv in the terminal
+func (s *Terminal) Command(argv []string) []string {
+	args := []string{s.Name}
+	replaced := false
+	for _, arg := range s.Args {
+		if arg == commandPlaceholder {
+			args = append(args, argv...)
+			replaced = true
+		} else {
+			args = append(args, arg)
+		}
+	}
+	if !replaced {
+		args = append(args, argv...)
+	}
+	return args
+}
+
+// terminalArgs runs command in the terminal, then keeps it open with an interactive shell
+func terminalArgs(command string) []string {
+	t := CurrentTerminal()
+	if t == nil {
+		log.Error("No terminal found, running without terminal")
+		return []string{"/bin/sh", "-c", command}
+	}
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		log.Warning("Cannot find shell to run command, using /bin/sh")
+		shell = "/bin/sh"
+	}
+	// A newline, so that a trailing comment in command does not hide the exec
+	return t.Command([]string{shell, "-i", "-c", command + "\nexec " + QuoteArgs([]string{shell})})
+}
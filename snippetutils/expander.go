@@ -0,0 +1,119 @@
+package snippetutils
+
+import (
+	"Goclip/db"
+	"Goclip/log"
+	"Goclip/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxTyped = 64
+const expansionDelay = 500 * time.Millisecond
+
+const (
+	charBackspace = '\b'
+	charTab       = '\t'
+	charSpace     = ' '
+)
+
+type Keyboard interface {
+	ReadText() string
+	ReplaceTyped(erase int, text string, cursorBack int, delimiter rune)
+}
+
+// Expander watches the typed characters and replaces snippet aliases with their body
+// once a delimiter (space or tab) is typed.
+type Expander struct {
+	snippets  *SnippetManager
+	db        db.GoclipDB
+	keyboard  Keyboard
+	mu        sync.Mutex
+	typed     []rune
+	expanding bool
+}
+
+func NewExpander(myDb db.GoclipDB, snippets *SnippetManager, keyboard Keyboard) *Expander {
+	return &Expander{db: myDb, snippets: snippets, keyboard: keyboard}
+}
+
+func (s *Expander) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.typed = nil
+}
+
+func (s *Expander) HandleChar(char rune) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expanding {
+		return
+	}
+	switch char {
+	case charBackspace:
+		if len(s.typed) > 0 {
+			s.typed = s.typed[:len(s.typed)-1]
+		}
+	case charSpace, charTab:
+		word := string(s.typed)
+		s.typed = nil
+		if word != "" {
+			s.expand(word, char)
+		}
+	default:
+		if char < charSpace || char == 0xFFFF {
+			s.typed = nil
+			return
+		}
+		s.typed = append(s.typed, char)
+		if len(s.typed) > maxTyped {
+			s.typed = s.typed[len(s.typed)-maxTyped:]
+		}
+	}
+}
+
+func (s *Expander) isEnabled() bool {
+	settings, err := s.db.GetSettings()
+	if err != nil {
+		settings = db.DefaultSettings()
+	}
+	if settings.ExpanderDisabled {
+		return false
+	}
+	if len(settings.ExpanderExcluded) == 0 {
+		return true
+	}
+	window, err := utils.ActiveWindow()
+	if err != nil {
+		return true
+	}
+	for _, class := range settings.ExpanderExcluded {
+		if strings.EqualFold(class, window.Class) {
+			log.Info("Text expansion disabled for: ", window.Class)
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Expander) expand(word string, delimiter rune) {
+	snippet := s.snippets.FindByAlias(word)
+	if snippet == nil || !s.isEnabled() {
+		return
+	}
+	log.Info("Expanding snippet: ", snippet.Name)
+	text, cursorBack, ok := Expand(snippet.Body, s.keyboard.ReadText(), nil)
+	if !ok {
+		return
+	}
+	// Ignore the keys we are about to send
+	s.expanding = true
+	go func() {
+		s.keyboard.ReplaceTyped(len([]rune(word))+1, text, cursorBack, delimiter)
+		time.Sleep(expansionDelay)
+		s.mu.Lock()
+		s.expanding = false
+		s.mu.Unlock()
+	}()
+}
@@ -0,0 +1,111 @@
+package snippetutils
+
+import (
+	"Goclip/db"
+	"Goclip/log"
+	"crypto/rand"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const cursorMarker = "{cursor}"
+
+var placeholderRegex = regexp.MustCompile(`\{(date|time|datetime|clipboard|uuid|cursor|input:[^{}]+)\}`)
+
+type SnippetManager struct {
+	db db.GoclipDB
+}
+
+func NewSnippetManager(myDb db.GoclipDB) *SnippetManager {
+	return &SnippetManager{db: myDb}
+}
+
+func (s *SnippetManager) GetSnippets() []*db.Snippet {
+	snippets := s.db.GetSnippets()
+	sort.Slice(snippets, func(i, j int) bool {
+		return strings.ToLower(snippets[i].Name) < strings.ToLower(snippets[j].Name)
+	})
+	return snippets
+}
+
+func (s *SnippetManager) FindByAlias(alias string) *db.Snippet {
+	for _, snippet := range s.db.GetSnippets() {
+		if snippet.Alias != "" && snippet.Alias == alias {
+			return snippet
+		}
+	}
+	return nil
+}
+
+func (s *SnippetManager) SaveSnippet(snippet *db.Snippet) error {
+	return s.db.SaveSnippet(snippet)
+}
+
+func (s *SnippetManager) DeleteSnippet(name string) error {
+	return s.db.DeleteSnippet(name)
+}
+
+func NewUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		log.Error("Error generating uuid: ", err)
+		return ""
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Expand replaces the placeholders in body. Each {input:Label} is asked once through prompt,
+// expansion is aborted when the prompt is cancelled. cursorBack is the number of characters
+// between the {cursor} marker and the end of the text.
+func Expand(body string, clipboardText string, prompt func(label string) (string, bool)) (text string, cursorBack int, ok bool) {
+	now := time.Now()
+	inputs := map[string]string{}
+	ok = true
+	text = placeholderRegex.ReplaceAllStringFunc(body, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		switch {
+		case name == "date":
+			return now.Format("2006-01-02")
+		case name == "time":
+			return now.Format("15:04:05")
+		case name == "datetime":
+			return now.Format("2006-01-02 15:04:05")
+		case name == "clipboard":
+			return clipboardText
+		case name == "uuid":
+			return NewUUID()
+		case name == "cursor":
+			return placeholder
+		case strings.HasPrefix(name, "input:"):
+			label := strings.TrimPrefix(name, "input:")
+			if value, found := inputs[label]; found {
+				return value
+			}
+			if !ok || prompt == nil {
+				return ""
+			}
+			value, accepted := prompt(label)
+			if !accepted {
+				ok = false
+				return ""
+			}
+			inputs[label] = value
+			return value
+		}
+		return placeholder
+	})
+	if !ok {
+		return "", 0, false
+	}
+	if idx := strings.Index(text, cursorMarker); idx >= 0 {
+		text = text[:idx] + strings.Replace(text[idx+len(cursorMarker):], cursorMarker, "", -1)
+		cursorBack = utf8.RuneCountInString(text[idx:])
+	}
+	return text, cursorBack, true
+}
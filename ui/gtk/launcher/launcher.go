@@ -10,14 +10,20 @@ import (
 	"Goclip/cliputils"
 	"Goclip/db"
 	"Goclip/log"
+	"Goclip/scriptutils"
 	"Goclip/shellutils"
+	"Goclip/snippetutils"
 	"Goclip/ui"
 	"Goclip/utils"
 	_ "embed"
+	"fmt"
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
+	"html"
 	"io/ioutil"
+	"reflect"
+	"sort"
 	"strings"
 	"time"
 	"unsafe"
@@ -28,6 +34,21 @@ const imgMaxSize = 250
 const iconMaxSize = 25
 const textMaxSize = 100
 
+const searchHelp = `text "quoted phrase" /regex/ -negated
+type:image|text|url|image/png  is:starred|tagged|used|expiring
+tag:name  collection:name  from:firefox  size:>1k
+after:2026-01-01  before:3d  on:tuesday|today|yesterday`
+
+const capturePrefix = ">"
+
+const maxRecords = 50
+
+// maxExecutableRows is the number of $PATH executables shown for a search
+const maxExecutableRows = 20
+
+const shellHelp = `Enter: run in the terminal
+Ctrl+Enter or >command: run in the background and copy the output`
+
 const opacityStarred = 1.0
 const opacityNotStarred = 0.25
 
@@ -40,22 +61,72 @@ const (
 )
 
 type Row struct {
-	Box      *gtk.Box
-	Id       string
-	MimeType string
-	IsApp    bool
-	IsClip   bool
-	IsShell  bool
+	Box       *gtk.Box
+	Label     *gtk.Label
+	Id        string
+	MimeType  string
+	Text      string
+	Display   string
+	Boost     int
+	Score     int
+	App       *db.AppEntry
+	IsApp     bool
+	IsClip    bool
+	IsShell   bool
+	IsSnippet bool
 }
 
 func (s *Row) IsSearchable() bool {
-	return strings.Contains(s.MimeType, "text") || s.IsApp
+	return strings.Contains(s.MimeType, "text") || s.IsApp || s.IsSnippet || s.IsClip
 }
 
 func (s *Row) IsText() bool {
 	return strings.Contains(s.MimeType, "text")
 }
 
+func (s *Row) Highlight(positions []int) {
+	if s.Label == nil {
+		return
+	}
+	if len(positions) == 0 {
+		s.Label.SetText(s.Display)
+	} else {
+		s.Label.SetMarkup(highlightMarkup(s.Display, positions))
+	}
+}
+
+// truncateText shortens text to max characters, never splitting one
+func truncateText(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max]) + " ..."
+}
+
+func highlightMarkup(text string, positions []int) string {
+	matched := map[int]bool{}
+	for _, pos := range positions {
+		matched[pos] = true
+	}
+	var markup strings.Builder
+	for i, r := range []rune(text) {
+		if matched[i] {
+			markup.WriteString("<b>" + html.EscapeString(string(r)) + "</b>")
+		} else {
+			markup.WriteString(html.EscapeString(string(r)))
+		}
+	}
+	return markup.String()
+}
+
+func newLabelButton(text string) (*gtk.Button, *gtk.Label) {
+	button, _ := gtk.ButtonNew()
+	label, _ := gtk.LabelNew(text)
+	button.Add(label)
+	return button, label
+}
+
 func ImageFromBytes(data []byte, maxSize int) *gtk.Image {
 	loader, err := gdk.PixbufLoaderNew()
 	if err != nil {
@@ -96,6 +167,20 @@ func ImageFromFile(fn string, maxSize int) *gtk.Image {
 	if fn == "" {
 		return nil
 	}
+	if strings.HasSuffix(fn, ".svg") {
+		// Render vector icons at the requested size instead of scaling them down
+		pixbuf, err := gdk.PixbufNewFromFileAtScale(fn, maxSize, maxSize, true)
+		if err != nil {
+			log.Error("Error opening icon: ", fn, " - ", err)
+			return nil
+		}
+		image, err := gtk.ImageNewFromPixbuf(pixbuf)
+		if err != nil {
+			log.Error("Error loading image: ", err)
+			return nil
+		}
+		return image
+	}
 	data, err := ioutil.ReadFile(fn)
 	if err != nil {
 		log.Error("Error opening icon: ", fn)
@@ -105,43 +190,55 @@ func ImageFromFile(fn string, maxSize int) *gtk.Image {
 }
 
 type GoclipLauncherGtk struct {
-	lType        LauncherType
-	title        string
-	clipManager  *cliputils.ClipboardManager
-	shellManager *shellutils.ShellManager
-	appManager   *apputils.AppManager
+	lType          LauncherType
+	title          string
+	clipManager    *cliputils.ClipboardManager
+	snippetManager *snippetutils.SnippetManager
+	shellManager   *shellutils.ShellManager
+	appManager     *apputils.AppManager
+	scripts        *scriptutils.ScriptManager
 
 	app        *gtk.Application
 	contentWin *gtk.Window
 	rows       []*Row
+	pathRows   []*Row
 	searchBox  *gtk.Entry
 	contentBox *gtk.Box
 	cmdBox     *gtk.Box
+	menu       *gtk.Menu
+	keepOpen   bool
 }
 
-func NewClipboardLauncher(myClip *cliputils.ClipboardManager) ui.GoclipLauncher {
+func NewClipboardLauncher(myClip *cliputils.ClipboardManager, snippetManager *snippetutils.SnippetManager) ui.GoclipLauncher {
 	o := &GoclipLauncherGtk{
-		clipManager: myClip,
-		lType:       LauncherTypeClipboard,
-		title:       utils.AppName + ": Clipboard",
+		clipManager:    myClip,
+		snippetManager: snippetManager,
+		lType:          LauncherTypeClipboard,
+		title:          utils.AppName + ": Clipboard",
 	}
 	myClip.SetReloadHistoryCallback(o.RedrawClipboardHistory)
 	return o
 }
 
 func NewAppsLauncher(appManager *apputils.AppManager) ui.GoclipLauncher {
-	return &GoclipLauncherGtk{
+	o := &GoclipLauncherGtk{
 		appManager: appManager,
 		lType:      LauncherTypeApps,
 		title:      utils.AppName + ": Applications",
 	}
+	appManager.SetReloadAppsCallback(func() {
+		glib.IdleAdd(o.updateApps)
+	})
+	return o
 }
 
-func NewShellLauncher(shellManager *shellutils.ShellManager) ui.GoclipLauncher {
+func NewShellLauncher(shellManager *shellutils.ShellManager, scripts *scriptutils.ScriptManager, clipManager *cliputils.ClipboardManager) ui.GoclipLauncher {
 	return &GoclipLauncherGtk{
 		lType:        LauncherTypeShell,
 		title:        utils.AppName + ": Shell",
 		shellManager: shellManager,
+		scripts:      scripts,
+		clipManager:  clipManager,
 	}
 }
 
@@ -149,6 +246,34 @@ func (s *GoclipLauncherGtk) Quit() {
 	s.app.Quit()
 }
 
+// drawScriptResults runs the script providers in the background, their results are shown
+// on top of the completions unless the query changed meanwhile
+func (s *GoclipLauncherGtk) drawScriptResults(text string) {
+	cmdBox := s.cmdBox
+	resultsBox, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 10)
+	cmdBox.Add(resultsBox)
+	go func() {
+		results := s.scripts.Query(text)
+		glib.IdleAdd(func() {
+			if s.cmdBox != cmdBox || len(results) == 0 {
+				return
+			}
+			for _, result := range results {
+				r := result
+				button, _ := gtk.ButtonNew()
+				button.SetHExpand(true)
+				button.SetLabel(r.Label)
+				button.Connect("clicked", func() {
+					s.contentWin.Destroy()
+					s.scripts.RunResult(r)
+				})
+				resultsBox.Add(button)
+			}
+			resultsBox.ShowAll()
+		})
+	}()
+}
+
 func (s *GoclipLauncherGtk) handleCompletions(text string) {
 	if s.cmdBox != nil {
 		s.cmdBox.Destroy()
@@ -157,7 +282,23 @@ func (s *GoclipLauncherGtk) handleCompletions(text string) {
 		s.searchBox.SetText(newText)
 		s.searchBox.SetPosition(-1)
 	}
-	s.cmdBox, _ = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	// The capture prefix is kept out of the completions
+	prefix := ""
+	if strings.HasPrefix(text, capturePrefix) {
+		prefix = capturePrefix
+		text = strings.TrimPrefix(text, capturePrefix)
+	}
+	s.cmdBox, _ = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 10)
+	if text != "" && s.scripts != nil {
+		s.drawScriptResults(text)
+	}
+	if text == "" {
+		s.drawRecords()
+		s.contentBox.Add(s.cmdBox)
+		s.contentBox.ShowAll()
+		return
+	}
+	columnsBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
 	histBox, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 10)
 	label, _ := gtk.LabelNew("Command history")
 	label.SetSizeRequest(windowWidth/2, 0)
@@ -174,16 +315,17 @@ func (s *GoclipLauncherGtk) handleCompletions(text string) {
 			if compl.Cmd == "" {
 				continue
 			}
-			button, _ := gtk.ButtonNew()
+			display := truncateText(compl.Cmd, textMaxSize/2)
+			button, label := newLabelButton(display)
 			button.SetHExpand(true)
-			if len(compl.Cmd) > textMaxSize/2 {
-				button.SetLabel(compl.Cmd[:textMaxSize/2] + " ...")
-			} else {
-				button.SetLabel(compl.Cmd)
+			if compl.IsHistory {
+				if _, positions, ok := utils.FuzzyMatch(text, compl.Cmd); ok {
+					label.SetMarkup(highlightMarkup(display, positions))
+				}
 			}
 			cmd := compl.Cmd
 			button.Connect("focus-in-event", func() {
-				s.searchBox.SetText(cmd)
+				s.searchBox.SetText(prefix + cmd)
 				s.searchBox.ShowAll()
 			})
 			button.Connect("clicked", func() {
@@ -193,11 +335,7 @@ func (s *GoclipLauncherGtk) handleCompletions(text string) {
 				btnEvt := gdk.EventButton{Event: evt}
 				if btnEvt.Type() == gdk.EVENT_BUTTON_PRESS {
 					if btnEvt.Button() == gdk.BUTTON_SECONDARY {
-						s.contentWin.Destroy()
-						if cmd != "" {
-							shellutils.Exec(cmd, true)
-							return
-						}
+						s.runCommand(cmd, prefix != "")
 					}
 				}
 			})
@@ -208,25 +346,116 @@ func (s *GoclipLauncherGtk) handleCompletions(text string) {
 			}
 		}
 	}
-	s.cmdBox.Add(histBox)
-	s.cmdBox.Add(shellBox)
+	columnsBox.Add(histBox)
+	columnsBox.Add(shellBox)
+	s.cmdBox.Add(columnsBox)
 	s.contentBox.Add(s.cmdBox)
 	s.contentBox.ShowAll()
 }
 
-func (s *GoclipLauncherGtk) rowContains(row *Row, text string) bool {
-	if !row.IsSearchable() {
-		return false
+// drawRecords lists the commands launched recently, to run them again
+func (s *GoclipLauncherGtk) drawRecords() {
+	label, _ := gtk.LabelNew("Recent commands")
+	s.cmdBox.Add(label)
+	for _, record := range s.shellManager.GetRecords(maxRecords) {
+		r := record
+		row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+		tsLabel, _ := gtk.LabelNew(utils.TimeToString(r.Start, false))
+		row.Add(tsLabel)
+		statusLabel, _ := gtk.LabelNew(recordStatus(r))
+		statusLabel.SetSizeRequest(40, 0)
+		row.Add(statusLabel)
+
+		display := r.Command
+		if r.Source == db.CommandSourceCapture {
+			display = capturePrefix + display
+		}
+		display = truncateText(display, textMaxSize)
+		button, _ := newLabelButton(display)
+		button.SetHExpand(true)
+		button.SetTooltipText(recordTooltip(r))
+		button.Connect("clicked", func() {
+			s.contentWin.Destroy()
+			if r.Source == db.CommandSourceCapture {
+				go s.clipManager.CaptureCommand(r.Command)
+			} else {
+				shellutils.Rerun(r)
+			}
+		})
+		button.Connect("button-press-event", func(btn *gtk.Button, evt *gdk.Event) {
+			btnEvt := gdk.EventButton{Event: evt}
+			if btnEvt.Type() == gdk.EVENT_BUTTON_PRESS && btnEvt.Button() == gdk.BUTTON_SECONDARY {
+				// Edit before running again
+				text := r.Command
+				if r.Source == db.CommandSourceCapture {
+					text = capturePrefix + text
+				}
+				s.searchBox.SetText(text)
+				s.searchBox.GrabFocus()
+			}
+		})
+		row.Add(button)
+		s.cmdBox.Add(row)
+	}
+}
+
+func recordStatus(record *db.CommandRecord) string {
+	switch {
+	case record.Running:
+		return "…"
+	case record.ExitCode == 0:
+		return "✓"
+	case record.ExitCode < 0:
+		return "✗"
+	}
+	return fmt.Sprintf("✗ %d", record.ExitCode)
+}
+
+func recordTooltip(record *db.CommandRecord) string {
+	lines := []string{
+		"Started: " + utils.TimeToString(record.Start, true),
+		"Directory: " + record.Dir,
+	}
+	if record.AppId != "" {
+		lines = append(lines, "App: "+record.AppId)
+	}
+	if record.Terminal {
+		lines = append(lines, "In terminal")
 	}
-	if row.IsApp {
-		return strings.Contains(strings.ToLower(row.Id), strings.ToLower(text))
+	if record.Running {
+		lines = append(lines, "Running")
+	} else if record.ExitCode >= 0 {
+		lines = append(lines, fmt.Sprintf("Exit status %d after %s", record.ExitCode, record.Duration.Round(time.Millisecond)))
 	}
-	if row.IsText() {
-		if entry, err := s.clipManager.GetEntry(row.Id); err == nil {
-			return strings.Contains(strings.ToLower(string(entry.Data)), strings.ToLower(text))
+	if record.Error != "" {
+		lines = append(lines, "Error: "+record.Error)
+	}
+	if record.Output != "" {
+		lines = append(lines, "", record.Output)
+	}
+	lines = append(lines, "", "Click: run again, right click: edit")
+	return strings.Join(lines, "\n")
+}
+
+// rankRow tells whether the row matches text, with its score and the positions to highlight
+func (s *GoclipLauncherGtk) rankRow(row *Row, text string, found map[string]*cliputils.SearchResult) (int, []int, bool) {
+	if !row.IsSearchable() {
+		return 0, nil, false
+	}
+	if row.IsClip {
+		result, ok := found[row.Id]
+		if !ok {
+			return 0, nil, false
 		}
+		return result.Score, result.Positions, true
+	}
+	if score, positions, ok := utils.FuzzyMatch(text, row.Display); ok {
+		return score + row.Boost, positions, true
 	}
-	return false
+	if score, _, ok := utils.FuzzyMatch(text, row.Text); ok {
+		return score + row.Boost, nil, true
+	}
+	return 0, nil, false
 }
 
 func (s *GoclipLauncherGtk) onSearching() {
@@ -239,14 +468,42 @@ func (s *GoclipLauncherGtk) onSearching() {
 	case LauncherTypeShell:
 		s.handleCompletions(text)
 	default:
-		for _, row := range s.rows {
-			if text == "" {
-				row.Box.Show()
-			} else if s.rowContains(row, text) {
+		s.clearExecutables()
+		if text == "" {
+			for i, row := range s.rows {
+				row.Highlight(nil)
 				row.Box.Show()
-			} else {
+				s.contentBox.ReorderChild(row.Box, i)
+			}
+			return
+		}
+		found := map[string]*cliputils.SearchResult{}
+		if s.lType == LauncherTypeClipboard {
+			for _, result := range s.clipManager.Search(text) {
+				found[result.Entry.Md5] = result
+			}
+		}
+		rows := s.rows
+		if s.lType == LauncherTypeApps {
+			rows = append(rows[:len(rows):len(rows)], s.drawExecutables(text)...)
+		}
+		var visible []*Row
+		for _, row := range rows {
+			score, positions, ok := s.rankRow(row, text, found)
+			if !ok {
 				row.Box.Hide()
+				continue
 			}
+			row.Score = score
+			row.Highlight(positions)
+			row.Box.Show()
+			visible = append(visible, row)
+		}
+		sort.SliceStable(visible, func(i, j int) bool {
+			return visible[i].Score > visible[j].Score
+		})
+		for i, row := range visible {
+			s.contentBox.ReorderChild(row.Box, i)
 		}
 	}
 }
@@ -269,13 +526,24 @@ func (s *GoclipLauncherGtk) drawSearchBox(layout *gtk.Box) {
 			s.searchBox.SetPosition(-1)
 		}()
 	})
+	if s.lType == LauncherTypeClipboard {
+		s.searchBox.SetTooltipText(searchHelp)
+	}
 	if s.lType == LauncherTypeShell {
+		s.searchBox.SetTooltipText(shellHelp)
 		s.searchBox.Connect("activate", func() {
 			cmd, _ := s.searchBox.GetText()
-			s.contentWin.Destroy()
-			if cmd != "" {
-				shellutils.Exec(cmd, true)
+			s.runCommand(cmd, strings.HasPrefix(cmd, capturePrefix))
+		})
+		s.searchBox.Connect("key-press-event", func(entry *gtk.Entry, evt *gdk.Event) bool {
+			keyEvt := gdk.EventKey{Event: evt}
+			key := keyEvt.KeyVal()
+			if (key == gdk.KEY_Return || key == gdk.KEY_KP_Enter) && keyEvt.State()&uint(gdk.CONTROL_MASK) != 0 {
+				cmd, _ := s.searchBox.GetText()
+				s.runCommand(cmd, true)
+				return true
 			}
+			return false
 		})
 	}
 	s.searchBox.GrabFocus()
@@ -284,6 +552,22 @@ func (s *GoclipLauncherGtk) drawSearchBox(layout *gtk.Box) {
 	layout.Add(row)
 }
 
+// runCommand runs cmd in the terminal, or in the background copying its output when capture is set
+func (s *GoclipLauncherGtk) runCommand(cmd string, capture bool) {
+	s.contentWin.Destroy()
+	if capture {
+		cmd = strings.TrimPrefix(cmd, capturePrefix)
+	}
+	if strings.TrimSpace(cmd) == "" {
+		return
+	}
+	if capture {
+		go s.clipManager.CaptureCommand(cmd)
+		return
+	}
+	shellutils.Exec(cmd, true)
+}
+
 func (s *GoclipLauncherGtk) handleClick(btn *gtk.Button, evt *gdk.Event, md5 string) {
 	btnEvt := gdk.EventButton{Event: evt}
 	keyEvt := gdk.EventKey{Event: evt}
@@ -297,12 +581,121 @@ func (s *GoclipLauncherGtk) handleClick(btn *gtk.Button, evt *gdk.Event, md5 str
 	} else if btnEvt.Type() == gdk.EVENT_BUTTON_PRESS && btnEvt.Button() == gdk.BUTTON_SECONDARY {
 		log.Info("Right click")
 		if entry, err := s.clipManager.GetEntry(md5); err == nil {
-			shellutils.OpenEntry(entry)
+			s.showEntryMenu(evt, entry)
 		}
-		s.contentWin.Destroy()
 	}
 }
 
+func (s *GoclipLauncherGtk) showEntryMenu(evt *gdk.Event, entry *db.ClipboardEntry) {
+	menu, err := gtk.MenuNew()
+	if err != nil {
+		log.Error("Error creating menu: ", err)
+		return
+	}
+	groups := map[string]*gtk.Menu{}
+	for _, action := range s.clipManager.EntryActions(entry) {
+		act := action
+		item, _ := gtk.MenuItemNewWithLabel(act.Label)
+		item.Connect("activate", func() {
+			s.runEntryAction(act, entry)
+		})
+		if act.Group == "" {
+			menu.Append(item)
+			continue
+		}
+		group, found := groups[act.Group]
+		if !found {
+			group, _ = gtk.MenuNew()
+			groups[act.Group] = group
+			groupItem, _ := gtk.MenuItemNewWithLabel(act.Group)
+			groupItem.SetSubmenu(group)
+			menu.Append(groupItem)
+		}
+		group.Append(item)
+	}
+	menu.Connect("deactivate", func() {
+		s.keepOpen = false
+	})
+	s.menu = menu
+	s.keepOpen = true
+	menu.ShowAll()
+	menu.PopupAtPointer(evt)
+}
+
+func (s *GoclipLauncherGtk) runEntryAction(action *cliputils.EntryAction, entry *db.ClipboardEntry) {
+	input := ""
+	if action.Prompt != "" {
+		var ok bool
+		if input, ok = s.prompt(action.Label, action.Prompt, action.Default); !ok {
+			return
+		}
+	}
+	s.contentWin.Destroy()
+	go func() {
+		if err := action.Run(entry, input); err != nil {
+			log.Error("Error running action ", action.Label, ": ", err)
+		}
+	}()
+}
+
+func (s *GoclipLauncherGtk) prompt(title string, text string, defaultValue string) (string, bool) {
+	s.keepOpen = true
+	defer func() {
+		s.keepOpen = false
+	}()
+	dialog, err := gtk.DialogNewWithButtons(title, s.contentWin, gtk.DIALOG_MODAL,
+		[]interface{}{"Cancel", gtk.RESPONSE_CANCEL},
+		[]interface{}{"OK", gtk.RESPONSE_OK})
+	if err != nil {
+		log.Error("Error creating dialog: ", err)
+		return "", false
+	}
+	defer dialog.Destroy()
+	dialog.SetDefaultResponse(gtk.RESPONSE_OK)
+	area, _ := dialog.GetContentArea()
+	label, _ := gtk.LabelNew(text)
+	area.Add(label)
+	input, _ := gtk.EntryNew()
+	input.SetActivatesDefault(true)
+	input.SetText(defaultValue)
+	area.Add(input)
+	dialog.ShowAll()
+	if dialog.Run() != gtk.RESPONSE_OK {
+		return "", false
+	}
+	value, err := input.GetText()
+	return value, err == nil
+}
+
+func entryTooltip(entry *db.ClipboardEntry) string {
+	var lines []string
+	if entry.Class != "" {
+		lines = append(lines, entry.Class)
+	}
+	if entry.SourceClass != "" || entry.SourceTitle != "" {
+		lines = append(lines, "From: "+strings.TrimSpace(entry.SourceClass+" - "+entry.SourceTitle))
+	}
+	lines = append(lines, "Copied: "+utils.TimeToString(entry.Timestamp, true))
+	if entry.Command != "" {
+		lines = append(lines, "Output of: "+entry.Command)
+	}
+	if entry.UseCount > 0 {
+		lines = append(lines, fmt.Sprintf("Used %d times, last: %s", entry.UseCount, utils.TimeToString(entry.LastUsed, true)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func entryLabels(entry *db.ClipboardEntry) string {
+	var labels []string
+	if entry.Collection != "" {
+		labels = append(labels, "["+entry.Collection+"]")
+	}
+	for _, tag := range entry.Tags {
+		labels = append(labels, "#"+tag)
+	}
+	return strings.Join(labels, " ")
+}
+
 func (s *GoclipLauncherGtk) drawEntry(entry *db.ClipboardEntry) {
 	row, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
 	if err != nil {
@@ -327,20 +720,31 @@ func (s *GoclipLauncherGtk) drawEntry(entry *db.ClipboardEntry) {
 	})
 	row.Add(starButton)
 
-	tsLabel, err := gtk.LabelNew(utils.TimeToString(entry.Timestamp, false))
+	tsLabel, err := gtk.LabelNew(utils.TimeToString(entry.LastActivity(), false))
 	row.Add(tsLabel)
 
-	entryButton, err := gtk.ButtonNew()
-	entryButton.SetHExpand(true)
-	if entry.IsText() {
-		var text string
-		if len(entry.Data) > textMaxSize {
-			text = string(append(entry.Data[:textMaxSize], " ..."...))
-		} else {
-			text = string(entry.Data)
+	if entry.Class == db.ClassColor {
+		if hex, ok := cliputils.ColorHex(string(entry.Data)); ok {
+			swatch, _ := gtk.LabelNew("")
+			swatch.SetMarkup("<span background=\"" + hex + "\">      </span>")
+			row.Add(swatch)
 		}
-		entryButton.SetLabel(text)
+	}
+
+	if labels := entryLabels(entry); labels != "" {
+		tagsLabel, _ := gtk.LabelNew("")
+		tagsLabel.SetMarkup("<small>" + html.EscapeString(labels) + "</small>")
+		row.Add(tagsLabel)
+	}
+
+	var entryButton *gtk.Button
+	var entryLabel *gtk.Label
+	var text string
+	if entry.IsText() {
+		text = truncateText(string(entry.Data), textMaxSize)
+		entryButton, entryLabel = newLabelButton(text)
 	} else if entry.IsImage() {
+		entryButton, _ = gtk.ButtonNew()
 		image := ImageFromBytes(entry.Data, imgMaxSize)
 		if image != nil {
 			entryButton.SetImage(image)
@@ -350,6 +754,9 @@ func (s *GoclipLauncherGtk) drawEntry(entry *db.ClipboardEntry) {
 		return
 	}
 
+	entryButton.SetHExpand(true)
+	entryButton.SetTooltipText(entryTooltip(entry))
+
 	md5 := entry.Md5
 	entryButton.Connect("button-press-event", func(btn *gtk.Button, evt *gdk.Event) {
 		s.handleClick(btn, evt, md5)
@@ -374,18 +781,73 @@ func (s *GoclipLauncherGtk) drawEntry(entry *db.ClipboardEntry) {
 	s.contentBox.Add(row)
 	s.rows = append(s.rows, &Row{
 		Box:      row,
+		Label:    entryLabel,
 		Id:       entry.Md5,
 		MimeType: entry.Mime,
+		Display:  text,
 		IsClip:   true,
 	})
 }
 
-func (s *GoclipLauncherGtk) drawApp(entry *db.AppEntry) {
+func (s *GoclipLauncherGtk) drawSnippet(snippet *db.Snippet) {
+	row, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	if err != nil {
+		log.Fatal("Error creating box: ", err)
+	}
+	aliasLabel, _ := gtk.LabelNew(snippet.Alias)
+	row.Add(aliasLabel)
+
+	label := snippet.Name
+	if len(snippet.Tags) > 0 {
+		label += " [" + strings.Join(snippet.Tags, ", ") + "]"
+	}
+	snippetButton, snippetLabel := newLabelButton(label)
+	snippetButton.SetHExpand(true)
+	snippetButton.SetTooltipText(snippet.Body)
+	snippetButton.Connect("clicked", func() {
+		s.insertSnippet(snippet)
+	})
+	row.Add(snippetButton)
+
+	s.contentBox.Add(row)
+	s.rows = append(s.rows, &Row{
+		Box:       row,
+		Label:     snippetLabel,
+		Id:        snippet.Name,
+		Display:   label,
+		Text:      strings.Join(append([]string{snippet.Name, snippet.Alias, snippet.Body}, snippet.Tags...), " "),
+		IsSnippet: true,
+	})
+}
+
+func (s *GoclipLauncherGtk) insertSnippet(snippet *db.Snippet) {
+	text, cursorBack, ok := snippetutils.Expand(snippet.Body, s.clipManager.ReadText(), func(label string) (string, bool) {
+		return s.prompt(snippet.Name, label+":", "")
+	})
+	if !ok {
+		return
+	}
+	s.contentWin.Destroy()
+	s.clipManager.WriteEntryWithCursor(&db.ClipboardEntry{Mime: "text/plain", Data: []byte(text)}, cursorBack)
+}
+
+func appSearchText(entry *db.AppEntry) string {
+	fields := []string{entry.GenericName, entry.Comment, entry.Exec}
+	fields = append(fields, entry.Keywords...)
+	fields = append(fields, entry.Categories...)
+	return strings.Join(fields, " ")
+}
+
+func (s *GoclipLauncherGtk) newAppRow(entry *db.AppEntry) *Row {
 	row, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
 	if err != nil {
 		log.Fatal("Error creating box: ", err)
 	}
-	tsLabel, err := gtk.LabelNew(utils.TimeToString(entry.AccessTime, false))
+	tsLabel, err := gtk.LabelNew("")
+	if entry.LaunchCount > 0 {
+		tsLabel.SetText(utils.TimeToString(entry.AccessTime, false))
+		tsLabel.SetTooltipText(fmt.Sprintf("Launched %d times", entry.LaunchCount))
+	}
 	row.Add(tsLabel)
 
 	image := ImageFromFile(entry.Icon, iconMaxSize)
@@ -396,22 +858,122 @@ func (s *GoclipLauncherGtk) drawApp(entry *db.AppEntry) {
 	img.SetSizeRequest(iconMaxSize, iconMaxSize)
 	row.Add(img)
 
-	entryButton, err := gtk.ButtonNew()
-	entryButton.SetLabel(entry.Name)
+	entryButton, entryLabel := newLabelButton(entry.Name)
 	entryButton.SetHExpand(true)
+	if entry.Comment != "" {
+		entryButton.SetTooltipText(entry.Comment)
+	}
 	entryButton.Connect("clicked", func() {
 		s.contentWin.Destroy()
 		log.Info("Entry: ", entry.File, " Exec: ", entry.Exec)
-		s.appManager.ExecEntry(entry)
+		s.appManager.ExecEntry(entry, nil)
+	})
+	entryButton.Connect("button-press-event", func(btn *gtk.Button, evt *gdk.Event) {
+		btnEvt := gdk.EventButton{Event: evt}
+		if btnEvt.Type() == gdk.EVENT_BUTTON_PRESS && btnEvt.Button() == gdk.BUTTON_SECONDARY {
+			s.showAppMenu(evt, entry)
+		}
 	})
 	row.Add(entryButton)
 
+	if len(entry.Actions) > 0 {
+		actionsButton, _ := gtk.ButtonNew()
+		actionsButton.SetLabel("...")
+		actionsButton.SetTooltipText("Actions")
+		actionsButton.Connect("button-press-event", func(btn *gtk.Button, evt *gdk.Event) {
+			s.showAppMenu(evt, entry)
+		})
+		row.Add(actionsButton)
+	}
+
 	s.contentBox.Add(row)
-	s.rows = append(s.rows, &Row{
-		Box:   row,
-		Id:    entry.Exec,
-		IsApp: true,
+	return &Row{
+		Box:     row,
+		Label:   entryLabel,
+		Id:      entry.Id,
+		Text:    appSearchText(entry),
+		Display: entry.Name,
+		Boost:   apputils.SearchBoost(entry),
+		App:     entry,
+		IsApp:   true,
+	}
+}
+
+func (s *GoclipLauncherGtk) drawApp(entry *db.AppEntry) {
+	s.rows = append(s.rows, s.newAppRow(entry))
+}
+
+// drawExecutables adds the rows of the $PATH executables matching text, which are not drawn
+// until searched
+func (s *GoclipLauncherGtk) drawExecutables(text string) []*Row {
+	skip := map[string]bool{}
+	for _, row := range s.rows {
+		skip[row.Id] = true
+	}
+	for _, entry := range s.appManager.FindExecutables(text, skip, maxExecutableRows) {
+		row := s.newAppRow(entry)
+		row.Box.ShowAll()
+		s.pathRows = append(s.pathRows, row)
+	}
+	return s.pathRows
+}
+
+func (s *GoclipLauncherGtk) clearExecutables() {
+	for _, row := range s.pathRows {
+		row.Box.Destroy()
+	}
+	s.pathRows = nil
+}
+
+func (s *GoclipLauncherGtk) showAppMenu(evt *gdk.Event, entry *db.AppEntry) {
+	menu, err := gtk.MenuNew()
+	if err != nil {
+		log.Error("Error creating menu: ", err)
+		return
+	}
+	for _, action := range entry.Actions {
+		act := action
+		item, _ := gtk.MenuItemNewWithLabel(act.Name)
+		item.Connect("activate", func() {
+			s.contentWin.Destroy()
+			log.Info("Entry: ", entry.File, " Action: ", act.Exec)
+			s.appManager.ExecEntry(entry, act)
+		})
+		menu.Append(item)
+	}
+	if len(entry.Actions) > 0 {
+		separator, _ := gtk.SeparatorMenuItemNew()
+		menu.Append(separator)
+	}
+	rename, _ := gtk.MenuItemNewWithLabel("Rename...")
+	rename.Connect("activate", func() {
+		if name, ok := s.prompt("Rename", "Name (empty for the original one):", entry.Name); ok {
+			s.appManager.RenameApp(entry, name)
+			s.updateApps()
+		}
+	})
+	menu.Append(rename)
+	icon, _ := gtk.MenuItemNewWithLabel("Change icon...")
+	icon.Connect("activate", func() {
+		if name, ok := s.prompt("Change icon", "Icon name or file (empty for the original one):", ""); ok {
+			s.appManager.SetAppIcon(entry, name)
+			s.updateApps()
+		}
 	})
+	menu.Append(icon)
+	hide, _ := gtk.MenuItemNewWithLabel("Hide")
+	hide.Connect("activate", func() {
+		s.appManager.HideApp(entry)
+		s.updateApps()
+	})
+	menu.Append(hide)
+	menu.Connect("deactivate", func() {
+		s.keepOpen = false
+	})
+	s.menu = menu
+	s.keepOpen = true
+	menu.ShowAll()
+	menu.PopupAtPointer(evt)
 }
 
 func (s *GoclipLauncherGtk) ShowEntries() {
@@ -426,27 +988,77 @@ func (s *GoclipLauncherGtk) drawEntries() {
 		}
 	case LauncherTypeApps:
 		if s.contentBox == nil {
-			s.RedrawApps()
+			s.drawApps()
 		}
 	default:
 		s.contentBox, _ = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 10)
+		s.cmdBox = nil
+		s.handleCompletions("")
 	}
 }
 
 func (s *GoclipLauncherGtk) RedrawClipboardHistory() {
 	s.contentBox, _ = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 10)
+	s.rows = nil
+	for _, snippet := range s.snippetManager.GetSnippets() {
+		s.drawSnippet(snippet)
+	}
 	for _, entry := range s.clipManager.GetEntries() {
 		s.drawEntry(entry)
 	}
 }
 
 func (s *GoclipLauncherGtk) RedrawApps() {
-	s.appManager.LoadApps()
+	s.appManager.ReloadApps()
+	glib.IdleAdd(s.updateApps)
+}
+
+func (s *GoclipLauncherGtk) drawApps() {
 	s.contentBox, _ = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 10)
-	log.Info("Redrawing apps")
+	s.rows = nil
+	s.pathRows = nil
+	log.Info("Drawing apps")
+	for _, entry := range s.appManager.GetApps() {
+		s.drawApp(entry)
+	}
+}
+
+// updateApps redraws only the rows of the apps changed since the last draw, then sorts them
+func (s *GoclipLauncherGtk) updateApps() {
+	s.clearExecutables()
+	if s.contentBox == nil {
+		s.drawApps()
+		return
+	}
+	oldRows := map[string]*Row{}
+	for _, row := range s.rows {
+		oldRows[row.Id] = row
+	}
+	s.rows = nil
+	updated := 0
 	for _, entry := range s.appManager.GetApps() {
+		row, found := oldRows[entry.Id]
+		if found {
+			delete(oldRows, entry.Id)
+			if reflect.DeepEqual(row.App, entry) {
+				row.Highlight(nil)
+				row.Box.Show()
+				s.rows = append(s.rows, row)
+				continue
+			}
+			row.Box.Destroy()
+		}
 		s.drawApp(entry)
+		updated++
+	}
+	for _, row := range oldRows {
+		row.Box.Destroy()
+	}
+	for i, row := range s.rows {
+		s.contentBox.ReorderChild(row.Box, i)
 	}
+	s.contentBox.ShowAll()
+	log.Info("Apps updated: ", updated, ", removed: ", len(oldRows))
 }
 
 func (s *GoclipLauncherGtk) showEntries() {
@@ -465,7 +1077,10 @@ func (s *GoclipLauncherGtk) showEntries() {
 
 	s.drawEntries()
 	contentScroll, err := gtk.ScrolledWindowNew(nil, nil)
-	contentScroll.Add(s.contentBox)
+	viewport, _ := gtk.ViewportNew(nil, nil)
+	shownBox := s.contentBox
+	viewport.Add(shownBox)
+	contentScroll.Add(viewport)
 	contentScroll.SetPolicy(gtk.POLICY_NEVER, gtk.POLICY_AUTOMATIC)
 	contentScroll.SetVExpand(true)
 
@@ -483,9 +1098,11 @@ func (s *GoclipLauncherGtk) showEntries() {
 	s.contentWin.Connect("focus-out-event", s.onFocusOut)
 	s.contentWin.Connect("key-press-event", s.onKeyPress)
 	s.contentWin.Connect("destroy", func() {
+		// Keep the rows alive for the next time the window is shown
+		viewport.Remove(shownBox)
 		switch s.lType {
 		case LauncherTypeApps:
-			go s.RedrawApps()
+			s.updateApps()
 		case LauncherTypeShell:
 			go s.shellManager.LoadHistory()
 		}
@@ -502,6 +1119,9 @@ func (s *GoclipLauncherGtk) showEntries() {
 }
 
 func (s *GoclipLauncherGtk) onFocusOut() {
+	if s.keepOpen {
+		return
+	}
 	s.contentWin.Destroy()
 }
 
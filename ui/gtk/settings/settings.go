@@ -3,6 +3,7 @@ package settings
 import (
 	"Goclip/db"
 	"Goclip/log"
+	"Goclip/shellutils"
 	"Goclip/ui"
 	"Goclip/utils"
 	_ "embed"
@@ -22,6 +23,8 @@ const (
 	iconName    = "Goclip"
 )
 
+const terminalAuto = "auto"
+
 type GoclipSettingsGtk struct {
 	db                db.GoclipDB
 	settingsWin       *gtk.Window
@@ -34,6 +37,13 @@ type GoclipSettingsGtk struct {
 	inputClipHookKey  *gtk.Entry
 	inputAppHookKey   *gtk.Entry
 	inputShellHookKey *gtk.Entry
+	inputStripParams  *gtk.CheckButton
+	inputParams       *gtk.Entry
+	inputExpander     *gtk.CheckButton
+	inputExcluded     *gtk.Entry
+	inputPathTerminal *gtk.CheckButton
+	inputTerminal     *gtk.ComboBoxText
+	inputTermTemplate *gtk.Entry
 
 	clipLauncher ui.GoclipLauncher
 	appLauncher  ui.GoclipLauncher
@@ -64,10 +74,6 @@ func (s *GoclipSettingsGtk) onReady() {
 	mSettings := systray.AddMenuItem("Settings", "")
 	mReload := systray.AddMenuItem("Reload Apps", "")
 	mQuit := systray.AddMenuItem("Quit", "")
-	if s.reloadAppsCb != nil {
-		log.Info("Reloading apps...")
-		go s.reloadAppsCb()
-	}
 	for {
 		select {
 		case <-mClip.ClickedCh:
@@ -120,6 +126,213 @@ func (s *GoclipSettingsGtk) drawClipboardSettings() {
 	s.inputClipHookKey.SetText(s.currSettings.ClipboardShortcut)
 	s.mainGrid.Attach(s.inputClipHookKey, 1, s.gridRows, 1, 1)
 	s.gridRows++
+
+	s.inputStripParams, _ = gtk.CheckButtonNewWithLabel("Strip tracking parameters from URLs")
+	s.inputStripParams.SetActive(s.currSettings.StripTrackingParams)
+	s.mainGrid.Attach(s.inputStripParams, 1, s.gridRows, 1, 1)
+	s.gridRows++
+
+	label, _ = gtk.LabelNew("Tracking parameters:")
+	label.SetHAlign(gtk.ALIGN_END)
+	s.mainGrid.Attach(label, 0, s.gridRows, 1, 1)
+
+	params := s.currSettings.TrackingParams
+	if params == nil {
+		params = db.DefaultTrackingParams()
+	}
+	s.inputParams, _ = gtk.EntryNew()
+	s.inputParams.SetText(strings.Join(params, ", "))
+	s.inputParams.SetTooltipText("Comma separated, * and ? wildcards allowed")
+	s.mainGrid.Attach(s.inputParams, 1, s.gridRows, 1, 1)
+	s.gridRows++
+}
+
+func (s *GoclipSettingsGtk) drawRulesSettings() {
+	label, _ := gtk.LabelNew("Clipboard rules")
+	s.mainGrid.Attach(label, 0, s.gridRows, 2, 1)
+	s.gridRows++
+
+	for _, rule := range s.db.GetRules() {
+		r := rule
+		row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+		enabled, _ := gtk.CheckButtonNewWithLabel(r.Match + " \"" + r.Pattern + "\" → " + r.Action + " " + r.Arg)
+		enabled.SetActive(r.Enabled)
+		enabled.SetHExpand(true)
+		enabled.Connect("toggled", func() {
+			r.Enabled = enabled.GetActive()
+			s.db.SaveRule(r)
+		})
+		row.Add(enabled)
+		delButton, _ := gtk.ButtonNew()
+		delButton.SetLabel("X")
+		delButton.Connect("clicked", func() {
+			s.db.DeleteRule(r.Id)
+			row.Destroy()
+		})
+		row.Add(delButton)
+		s.mainGrid.Attach(row, 0, s.gridRows, 2, 1)
+		s.gridRows++
+	}
+
+	row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	match, _ := gtk.ComboBoxTextNew()
+	for _, m := range db.RuleMatchers {
+		match.AppendText(m)
+	}
+	match.SetActive(0)
+	row.Add(match)
+	pattern, _ := gtk.EntryNew()
+	pattern.SetPlaceholderText("Pattern")
+	pattern.SetTooltipText("mime: glob (text/*), class: url, email, ..., regex: content regex, window: WM_CLASS regex")
+	row.Add(pattern)
+	action, _ := gtk.ComboBoxTextNew()
+	for _, a := range db.RuleActions {
+		action.AppendText(a)
+	}
+	action.SetActive(0)
+	row.Add(action)
+	arg, _ := gtk.EntryNew()
+	arg.SetPlaceholderText("Argument")
+	arg.SetTooltipText("transform: filter command, tag: tags, expire: minutes, command: command reading the content on stdin")
+	arg.SetHExpand(true)
+	row.Add(arg)
+	addButton, _ := gtk.ButtonNew()
+	addButton.SetLabel("Add")
+	addButton.Connect("clicked", func() {
+		patternText, _ := pattern.GetText()
+		argText, _ := arg.GetText()
+		rule := &db.Rule{
+			Match:   match.GetActiveText(),
+			Pattern: patternText,
+			Action:  action.GetActiveText(),
+			Arg:     argText,
+			Enabled: true,
+		}
+		if err := s.db.SaveRule(rule); err != nil {
+			s.showMessage("Error saving rule")
+			return
+		}
+		s.showSettings()
+	})
+	row.Add(addButton)
+	s.mainGrid.Attach(row, 0, s.gridRows, 2, 1)
+	s.gridRows++
+}
+
+func (s *GoclipSettingsGtk) drawSnippetSettings() {
+	label, _ := gtk.LabelNew("Snippets")
+	s.mainGrid.Attach(label, 0, s.gridRows, 2, 1)
+	s.gridRows++
+
+	s.inputExpander, _ = gtk.CheckButtonNewWithLabel("Expand aliases while typing")
+	s.inputExpander.SetActive(!s.currSettings.ExpanderDisabled)
+	s.mainGrid.Attach(s.inputExpander, 1, s.gridRows, 1, 1)
+	s.gridRows++
+
+	label, _ = gtk.LabelNew("Disabled in:")
+	label.SetHAlign(gtk.ALIGN_END)
+	s.mainGrid.Attach(label, 0, s.gridRows, 1, 1)
+
+	s.inputExcluded, _ = gtk.EntryNew()
+	s.inputExcluded.SetText(strings.Join(s.currSettings.ExpanderExcluded, ", "))
+	s.inputExcluded.SetTooltipText("Comma separated window classes (WM_CLASS)")
+	s.mainGrid.Attach(s.inputExcluded, 1, s.gridRows, 1, 1)
+	s.gridRows++
+
+	name, _ := gtk.EntryNew()
+	alias, _ := gtk.EntryNew()
+	tags, _ := gtk.EntryNew()
+	body, _ := gtk.TextViewNew()
+	bodyBuffer, _ := body.GetBuffer()
+	// The name of the edited snippet, the snippets are stored by name
+	editing := ""
+
+	for _, snippet := range s.db.GetSnippets() {
+		sn := snippet
+		row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+		editButton, _ := gtk.ButtonNew()
+		editButton.SetLabel(sn.Name + " (" + sn.Alias + ")")
+		editButton.SetHExpand(true)
+		editButton.Connect("clicked", func() {
+			editing = sn.Name
+			name.SetText(sn.Name)
+			alias.SetText(sn.Alias)
+			tags.SetText(strings.Join(sn.Tags, ", "))
+			bodyBuffer.SetText(sn.Body)
+		})
+		row.Add(editButton)
+		delButton, _ := gtk.ButtonNew()
+		delButton.SetLabel("X")
+		delButton.Connect("clicked", func() {
+			s.db.DeleteSnippet(sn.Name)
+			s.clipLauncher.RedrawClipboardHistory()
+			row.Destroy()
+		})
+		row.Add(delButton)
+		s.mainGrid.Attach(row, 0, s.gridRows, 2, 1)
+		s.gridRows++
+	}
+
+	for _, input := range []struct {
+		label string
+		entry *gtk.Entry
+	}{{"Name:", name}, {"Alias:", alias}, {"Tags:", tags}} {
+		label, _ = gtk.LabelNew(input.label)
+		label.SetHAlign(gtk.ALIGN_END)
+		s.mainGrid.Attach(label, 0, s.gridRows, 1, 1)
+		s.mainGrid.Attach(input.entry, 1, s.gridRows, 1, 1)
+		s.gridRows++
+	}
+
+	label, _ = gtk.LabelNew("Body:")
+	label.SetHAlign(gtk.ALIGN_END)
+	s.mainGrid.Attach(label, 0, s.gridRows, 1, 1)
+	body.SetSizeRequest(0, 80)
+	body.SetTooltipText("Placeholders: {date} {time} {datetime} {clipboard} {uuid} {input:Label} {cursor}")
+	s.mainGrid.Attach(body, 1, s.gridRows, 1, 1)
+	s.gridRows++
+
+	saveButton, _ := gtk.ButtonNew()
+	saveButton.SetLabel("Save snippet")
+	saveButton.Connect("clicked", func() {
+		nameText, _ := name.GetText()
+		aliasText, _ := alias.GetText()
+		tagsText, _ := tags.GetText()
+		start, end := bodyBuffer.GetBounds()
+		bodyText, _ := bodyBuffer.GetText(start, end, true)
+		if strings.TrimSpace(nameText) == "" {
+			s.showMessage("Snippet name required")
+			return
+		}
+		snippet := &db.Snippet{
+			Name:  strings.TrimSpace(nameText),
+			Alias: strings.TrimSpace(aliasText),
+			Body:  bodyText,
+			Tags:  splitList(tagsText),
+		}
+		if err := s.db.SaveSnippet(snippet); err != nil {
+			s.showMessage("Error saving snippet")
+			return
+		}
+		// A renamed snippet is saved under its new name, the old one is removed
+		if editing != "" && editing != snippet.Name {
+			s.db.DeleteSnippet(editing)
+		}
+		s.clipLauncher.RedrawClipboardHistory()
+		s.showSettings()
+	})
+	s.mainGrid.Attach(saveButton, 1, s.gridRows, 1, 1)
+	s.gridRows++
+}
+
+func splitList(text string) []string {
+	values := []string{}
+	for _, value := range strings.Split(text, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
 }
 
 func (s *GoclipSettingsGtk) drawAppSettings() {
@@ -135,6 +348,141 @@ func (s *GoclipSettingsGtk) drawAppSettings() {
 	s.inputAppHookKey.SetText(s.currSettings.AppsShortcut)
 	s.mainGrid.Attach(s.inputAppHookKey, 1, s.gridRows, 1, 1)
 	s.gridRows++
+
+	s.inputPathTerminal, _ = gtk.CheckButtonNewWithLabel("Run PATH executables in the terminal")
+	s.inputPathTerminal.SetActive(s.currSettings.PathInTerminal)
+	s.mainGrid.Attach(s.inputPathTerminal, 1, s.gridRows, 1, 1)
+	s.gridRows++
+}
+
+func (s *GoclipSettingsGtk) reloadApps() {
+	if s.reloadAppsCb != nil {
+		go s.reloadAppsCb()
+	}
+}
+
+func (s *GoclipSettingsGtk) drawCustomAppSettings() {
+	label, _ := gtk.LabelNew("Custom launcher entries")
+	s.mainGrid.Attach(label, 0, s.gridRows, 2, 1)
+	s.gridRows++
+
+	editId := 0
+	name, _ := gtk.EntryNew()
+	command, _ := gtk.EntryNew()
+	icon, _ := gtk.EntryNew()
+	dir, _ := gtk.EntryNew()
+	keywords, _ := gtk.EntryNew()
+	terminal, _ := gtk.CheckButtonNewWithLabel("Run in terminal")
+
+	for _, app := range s.db.GetCustomApps() {
+		a := app
+		row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+		editButton, _ := gtk.ButtonNew()
+		editButton.SetLabel(a.Name + " (" + a.Command + ")")
+		editButton.SetHExpand(true)
+		editButton.Connect("clicked", func() {
+			editId = a.Id
+			name.SetText(a.Name)
+			command.SetText(a.Command)
+			icon.SetText(a.Icon)
+			dir.SetText(a.Path)
+			keywords.SetText(strings.Join(a.Keywords, ", "))
+			terminal.SetActive(a.Terminal)
+		})
+		row.Add(editButton)
+		delButton, _ := gtk.ButtonNew()
+		delButton.SetLabel("X")
+		delButton.Connect("clicked", func() {
+			s.db.DeleteCustomApp(a.Id)
+			s.reloadApps()
+			row.Destroy()
+		})
+		row.Add(delButton)
+		s.mainGrid.Attach(row, 0, s.gridRows, 2, 1)
+		s.gridRows++
+	}
+
+	icon.SetTooltipText("Icon name from the icon theme or image file")
+	dir.SetTooltipText("Working directory, ~/ allowed")
+	keywords.SetTooltipText("Comma separated search keywords")
+	for _, input := range []struct {
+		label string
+		entry *gtk.Entry
+	}{{"Name:", name}, {"Command:", command}, {"Icon:", icon}, {"Directory:", dir}, {"Keywords:", keywords}} {
+		label, _ = gtk.LabelNew(input.label)
+		label.SetHAlign(gtk.ALIGN_END)
+		s.mainGrid.Attach(label, 0, s.gridRows, 1, 1)
+		s.mainGrid.Attach(input.entry, 1, s.gridRows, 1, 1)
+		s.gridRows++
+	}
+	s.mainGrid.Attach(terminal, 1, s.gridRows, 1, 1)
+	s.gridRows++
+
+	saveButton, _ := gtk.ButtonNew()
+	saveButton.SetLabel("Save entry")
+	saveButton.Connect("clicked", func() {
+		nameText, _ := name.GetText()
+		commandText, _ := command.GetText()
+		iconText, _ := icon.GetText()
+		dirText, _ := dir.GetText()
+		keywordsText, _ := keywords.GetText()
+		app := &db.CustomApp{
+			Id:       editId,
+			Name:     strings.TrimSpace(nameText),
+			Command:  strings.TrimSpace(commandText),
+			Icon:     strings.TrimSpace(iconText),
+			Path:     strings.TrimSpace(dirText),
+			Terminal: terminal.GetActive(),
+			Keywords: splitList(keywordsText),
+		}
+		if app.Name == "" || app.Command == "" {
+			s.showMessage("Entry name and command required")
+			return
+		}
+		if err := s.db.SaveCustomApp(app); err != nil {
+			s.showMessage("Error saving entry")
+			return
+		}
+		s.reloadApps()
+		s.showSettings()
+	})
+	s.mainGrid.Attach(saveButton, 1, s.gridRows, 1, 1)
+	s.gridRows++
+
+	overrides := s.db.GetAppOverrides()
+	if len(overrides) == 0 {
+		return
+	}
+	label, _ = gtk.LabelNew("Hidden and changed apps")
+	s.mainGrid.Attach(label, 0, s.gridRows, 2, 1)
+	s.gridRows++
+	for _, override := range overrides {
+		o := override
+		var changes []string
+		if o.Hidden {
+			changes = append(changes, "hidden")
+		}
+		if o.Name != "" {
+			changes = append(changes, "name: "+o.Name)
+		}
+		if o.Icon != "" {
+			changes = append(changes, "icon: "+o.Icon)
+		}
+		row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+		overrideLabel, _ := gtk.LabelNew(o.AppId + " (" + strings.Join(changes, ", ") + ")")
+		overrideLabel.SetHAlign(gtk.ALIGN_START)
+		overrideLabel.SetHExpand(true)
+		row.Add(overrideLabel)
+		restoreButton, _ := gtk.ButtonNew()
+		restoreButton.SetLabel("Restore")
+		restoreButton.Connect("clicked", func() {
+			s.db.DeleteAppOverride(o.AppId)
+			row.Destroy()
+		})
+		row.Add(restoreButton)
+		s.mainGrid.Attach(row, 0, s.gridRows, 2, 1)
+		s.gridRows++
+	}
 }
 
 func (s *GoclipSettingsGtk) drawShellSettings() {
@@ -150,6 +498,103 @@ func (s *GoclipSettingsGtk) drawShellSettings() {
 	s.inputShellHookKey.SetText(s.currSettings.ShellShortcut)
 	s.mainGrid.Attach(s.inputShellHookKey, 1, s.gridRows, 1, 1)
 	s.gridRows++
+
+	label, _ = gtk.LabelNew("Terminal:")
+	label.SetHAlign(gtk.ALIGN_END)
+	s.mainGrid.Attach(label, 0, s.gridRows, 1, 1)
+
+	detected := "none found"
+	if t := shellutils.DetectTerminal(); t != nil {
+		detected = t.Name
+	}
+	s.inputTerminal, _ = gtk.ComboBoxTextNew()
+	s.inputTerminal.Append(terminalAuto, "Automatic ("+detected+")")
+	for _, t := range shellutils.Terminals {
+		s.inputTerminal.Append(t.Name, t.Name)
+	}
+	s.inputTerminal.Append(shellutils.TerminalCustom, "Custom")
+	if s.currSettings.Terminal == "" || !s.inputTerminal.SetActiveID(s.currSettings.Terminal) {
+		s.inputTerminal.SetActiveID(terminalAuto)
+	}
+	s.mainGrid.Attach(s.inputTerminal, 1, s.gridRows, 1, 1)
+	s.gridRows++
+
+	label, _ = gtk.LabelNew("Custom terminal:")
+	label.SetHAlign(gtk.ALIGN_END)
+	s.mainGrid.Attach(label, 0, s.gridRows, 1, 1)
+
+	s.inputTermTemplate, _ = gtk.EntryNew()
+	s.inputTermTemplate.SetText(s.currSettings.TerminalTemplate)
+	s.inputTermTemplate.SetPlaceholderText("myterm --exec {}")
+	s.inputTermTemplate.SetTooltipText("Terminal and its arguments, {} is replaced by the command to run")
+	s.mainGrid.Attach(s.inputTermTemplate, 1, s.gridRows, 1, 1)
+	s.gridRows++
+}
+
+func (s *GoclipSettingsGtk) drawEnvSettings() {
+	label, _ := gtk.LabelNew("Launch environment overrides")
+	s.mainGrid.Attach(label, 0, s.gridRows, 2, 1)
+	s.gridRows++
+
+	for _, override := range s.db.GetEnvOverrides() {
+		o := override
+		row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+		text := o.App + ": " + o.Name + "=" + o.Value
+		if o.Value == "" {
+			text = o.App + ": unset " + o.Name
+		}
+		overrideLabel, _ := gtk.LabelNew(text)
+		overrideLabel.SetHAlign(gtk.ALIGN_START)
+		overrideLabel.SetHExpand(true)
+		row.Add(overrideLabel)
+		delButton, _ := gtk.ButtonNew()
+		delButton.SetLabel("X")
+		delButton.Connect("clicked", func() {
+			s.db.DeleteEnvOverride(o.Id)
+			row.Destroy()
+		})
+		row.Add(delButton)
+		s.mainGrid.Attach(row, 0, s.gridRows, 2, 1)
+		s.gridRows++
+	}
+
+	row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	app, _ := gtk.EntryNew()
+	app.SetPlaceholderText("App")
+	app.SetTooltipText("Desktop file ID (firefox.desktop), command name (htop) or * for all")
+	row.Add(app)
+	name, _ := gtk.EntryNew()
+	name.SetPlaceholderText("Variable")
+	row.Add(name)
+	value, _ := gtk.EntryNew()
+	value.SetPlaceholderText("Value")
+	value.SetTooltipText("Leave empty to unset the variable")
+	value.SetHExpand(true)
+	row.Add(value)
+	addButton, _ := gtk.ButtonNew()
+	addButton.SetLabel("Add")
+	addButton.Connect("clicked", func() {
+		appText, _ := app.GetText()
+		nameText, _ := name.GetText()
+		valueText, _ := value.GetText()
+		override := &db.EnvOverride{
+			App:   strings.TrimSpace(appText),
+			Name:  strings.TrimSpace(nameText),
+			Value: valueText,
+		}
+		if override.App == "" || override.Name == "" || strings.Contains(override.Name, "=") {
+			s.showMessage("App and variable name required")
+			return
+		}
+		if err := s.db.SaveEnvOverride(override); err != nil {
+			s.showMessage("Error saving environment override")
+			return
+		}
+		s.showSettings()
+	})
+	row.Add(addButton)
+	s.mainGrid.Attach(row, 0, s.gridRows, 2, 1)
+	s.gridRows++
 }
 
 func (s *GoclipSettingsGtk) parseShortcut(shortcut string) (string, string) {
@@ -209,13 +654,27 @@ func (s *GoclipSettingsGtk) showSettings() {
 
 	s.drawClipboardSettings()
 	s.drawAppSettings()
+	s.drawCustomAppSettings()
 	s.drawShellSettings()
+	s.drawEnvSettings()
+	s.drawRulesSettings()
+	s.drawSnippetSettings()
 
-	mainLayout.Add(s.mainGrid)
+	gridScroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	gridScroll.Add(s.mainGrid)
+	gridScroll.SetPolicy(gtk.POLICY_NEVER, gtk.POLICY_AUTOMATIC)
+	gridScroll.SetVExpand(true)
+	mainLayout.Add(gridScroll)
 
 	save, err := gtk.ButtonNew()
 	save.SetLabel("Save")
 	save.Connect("clicked", func() {
+		terminal := s.inputTerminal.GetActiveID()
+		template, _ := s.inputTermTemplate.GetText()
+		if terminal == shellutils.TerminalCustom && shellutils.ParseTerminal(template) == nil {
+			s.showMessage("Valid custom terminal command required")
+			return
+		}
 		maxEntriesStr, _ := s.inputMaxEntries.GetText()
 		maxEntries, err := strconv.Atoi(maxEntriesStr)
 		if err != nil {
@@ -223,6 +682,18 @@ func (s *GoclipSettingsGtk) showSettings() {
 			maxEntries = s.currSettings.MaxEntries
 		}
 		s.currSettings.MaxEntries = maxEntries
+		s.currSettings.StripTrackingParams = s.inputStripParams.GetActive()
+		params, _ := s.inputParams.GetText()
+		s.currSettings.TrackingParams = splitList(params)
+		s.currSettings.ExpanderDisabled = !s.inputExpander.GetActive()
+		excluded, _ := s.inputExcluded.GetText()
+		s.currSettings.ExpanderExcluded = splitList(excluded)
+		s.currSettings.PathInTerminal = s.inputPathTerminal.GetActive()
+		s.currSettings.Terminal = terminal
+		if s.currSettings.Terminal == terminalAuto {
+			s.currSettings.Terminal = ""
+		}
+		s.currSettings.TerminalTemplate = strings.TrimSpace(template)
 		s.checkKeyHooks()
 		s.db.SaveSettings(s.currSettings)
 	})
@@ -256,7 +727,7 @@ func (s *GoclipSettingsGtk) showSettings() {
 
 	mainLayout.Add(s.message)
 	s.settingsWin.Add(mainLayout)
-	s.settingsWin.SetDefaultSize(500, 250)
+	s.settingsWin.SetDefaultSize(500, 600)
 	s.settingsWin.SetPosition(gtk.WIN_POS_MOUSE)
 	s.settingsWin.SetKeepAbove(true)
 	s.settingsWin.SetSkipTaskbarHint(true)
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"math"
+	"time"
+	"unicode"
+)
+
+const (
+	scoreMatch       = 16
+	bonusConsecutive = 12
+	bonusBoundary    = 10
+	bonusCamel       = 8
+	bonusExact       = 24
+	maxGapPenalty    = 48
+)
+
+// FuzzyMatch checks that the runes of pattern appear in order in text, ignoring case.
+// It returns a score, higher for consecutive runes and runes at the start of words,
+// and the rune positions of the match in text.
+func FuzzyMatch(pattern string, text string) (int, []int, bool) {
+	p := lowerRunes(pattern)
+	if len(p) == 0 {
+		return 0, nil, true
+	}
+	orig := []rune(text)
+	t := lowerRunes(text)
+
+	// Find the end of the first match, then walk backwards for the shortest one
+	pi := 0
+	end := -1
+	for i := 0; i < len(t); i++ {
+		if t[i] == p[pi] {
+			pi++
+			if pi == len(p) {
+				end = i
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+	positions := make([]int, len(p))
+	pi = len(p) - 1
+	for i := end; i >= 0 && pi >= 0; i-- {
+		if t[i] == p[pi] {
+			positions[pi] = i
+			pi--
+		}
+	}
+	score := fuzzyScore(orig, positions)
+
+	// A contiguous occurrence can score better than the shortest subsequence
+	if idx := indexRunes(t, p); idx >= 0 && idx != positions[0] {
+		exact := make([]int, len(p))
+		for i := range exact {
+			exact[i] = idx + i
+		}
+		if exactScore := fuzzyScore(orig, exact); exactScore > score {
+			score, positions = exactScore, exact
+		}
+	}
+	if isContiguous(positions) {
+		score += bonusExact
+	}
+	return score, positions, true
+}
+
+// lowerRunes lowers each rune on its own, unlike strings.ToLower the positions stay the same
+func lowerRunes(text string) []rune {
+	runes := []rune(text)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+func fuzzyScore(text []rune, positions []int) int {
+	score := 0
+	for i, pos := range positions {
+		score += scoreMatch
+		if i > 0 && positions[i-1] == pos-1 {
+			score += bonusConsecutive
+		}
+		if pos == 0 {
+			score += bonusBoundary
+		} else {
+			prev := text[pos-1]
+			if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+				score += bonusBoundary
+			} else if unicode.IsLower(prev) && unicode.IsUpper(text[pos]) {
+				score += bonusCamel
+			}
+		}
+	}
+	gaps := positions[len(positions)-1] - positions[0] + 1 - len(positions)
+	if gaps > maxGapPenalty {
+		gaps = maxGapPenalty
+	}
+	start := positions[0]
+	if start > maxGapPenalty/4 {
+		start = maxGapPenalty / 4
+	}
+	return score - gaps - start
+}
+
+func indexRunes(text []rune, pattern []rune) int {
+	for i := 0; i+len(pattern) <= len(text); i++ {
+		found := true
+		for j := range pattern {
+			if text[i+j] != pattern[j] {
+				found = false
+				break
+			}
+		}
+		if found {
+			return i
+		}
+	}
+	return -1
+}
+
+func isContiguous(positions []int) bool {
+	for i := 1; i < len(positions); i++ {
+		if positions[i] != positions[i-1]+1 {
+			return false
+		}
+	}
+	return true
+}
+
+const frecencyHalfLife = 7 * 24 * time.Hour
+
+// DecayScore halves a frecency score every week since last
+func DecayScore(score float64, last time.Time) float64 {
+	if score == 0 || last.IsZero() {
+		return score
+	}
+	return score * math.Pow(0.5, float64(time.Since(last))/float64(frecencyHalfLife))
+}
+
+// ScoreBoost turns a frecency score into a ranking bonus, logarithmic so that heavy use
+// cannot hide a much better text match
+func ScoreBoost(score float64) int {
+	return int(math.Round(16 * math.Log2(score+1)))
+}
+
+// Frecency is the ranking bonus of something used count times, the last time at last.
+// It uses the same model as DecayScore, as if all the uses happened at last.
+func Frecency(count int, last time.Time) int {
+	if count <= 0 {
+		return 0
+	}
+	return ScoreBoost(DecayScore(float64(count), last))
+}
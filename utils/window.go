@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"github.com/robotn/xgbutil"
+	"github.com/robotn/xgbutil/ewmh"
+	"github.com/robotn/xgbutil/icccm"
+	"sync"
+)
+
+var xConn *xgbutil.XUtil
+var xConnErr error
+var xConnOnce sync.Once
+
+type WindowInfo struct {
+	Class string
+	Title string
+}
+
+func ActiveWindow() (*WindowInfo, error) {
+	xConnOnce.Do(func() {
+		xConn, xConnErr = xgbutil.NewConn()
+	})
+	if xConnErr != nil {
+		return nil, xConnErr
+	}
+	win, err := ewmh.ActiveWindowGet(xConn)
+	if err != nil {
+		return nil, err
+	}
+	info := &WindowInfo{}
+	if wmClass, err := icccm.WmClassGet(xConn, win); err == nil {
+		info.Class = wmClass.Class
+	}
+	if title, err := ewmh.WmNameGet(xConn, win); err == nil {
+		info.Title = title
+	} else if title, err := icccm.WmNameGet(xConn, win); err == nil {
+		info.Title = title
+	}
+	return info, nil
+}